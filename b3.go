@@ -0,0 +1,176 @@
+package tracer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// The headers used by B3 propagation.
+const (
+	b3TraceID      = "x-b3-traceid"
+	b3SpanID       = "x-b3-spanid"
+	b3ParentSpanID = "x-b3-parentspanid"
+	b3Sampled      = "x-b3-sampled"
+	b3Flags        = "x-b3-flags"
+	b3Single       = "b3"
+)
+
+// b3ID parses a B3 ID. B3 allows 128 bit trace IDs, in which case
+// only the lower 64 bits are used.
+func b3ID(s string) (uint64, bool) {
+	if len(s) > 16 {
+		s = s[len(s)-16:]
+	}
+	id, err := strconv.ParseUint(s, 16, 64)
+	return id, err == nil
+}
+
+func b3Injecter(sm SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	w.Set(b3TraceID, idToHex(sm.TraceID))
+	w.Set(b3SpanID, idToHex(sm.SpanID))
+	if sm.ParentID != 0 {
+		w.Set(b3ParentSpanID, idToHex(sm.ParentID))
+	}
+	if sm.Flags&FlagDebug > 0 {
+		w.Set(b3Flags, "1")
+	} else if sm.Flags&FlagSampled > 0 {
+		w.Set(b3Sampled, "1")
+	} else if !sm.deferred {
+		w.Set(b3Sampled, "0")
+	}
+	return nil
+}
+
+func b3Extracter(carrier interface{}) (SpanContext, error) {
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	ctx := SpanContext{Baggage: map[string]string{}}
+	valid := true
+	decided := false
+	err := r.ForeachKey(func(key string, val string) error {
+		var ok bool
+		switch strings.ToLower(key) {
+		case b3TraceID:
+			ctx.TraceID, ok = b3ID(val)
+		case b3SpanID:
+			ctx.SpanID, ok = b3ID(val)
+		case b3ParentSpanID:
+			ctx.ParentID, ok = b3ID(val)
+		case b3Sampled:
+			ok = true
+			decided = true
+			if val == "1" || strings.EqualFold(val, "true") {
+				ctx.Flags |= FlagSampled
+			}
+		case b3Flags:
+			ok = true
+			if val == "1" {
+				decided = true
+				ctx.Flags |= FlagSampled | FlagDebug
+			}
+		default:
+			ok = true
+		}
+		valid = valid && ok
+		return nil
+	})
+	if err != nil {
+		return SpanContext{}, err
+	}
+	if !valid || ctx.TraceID == 0 || ctx.SpanID == 0 {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	// Without a sampling state, B3 defers the decision to us.
+	ctx.deferred = !decided
+	return ctx, nil
+}
+
+func b3SingleInjecter(sm SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	sampled := "0"
+	if sm.Flags&FlagDebug > 0 {
+		sampled = "d"
+	} else if sm.Flags&FlagSampled > 0 {
+		sampled = "1"
+	}
+	v := idToHex(sm.TraceID) + "-" + idToHex(sm.SpanID)
+	if sm.deferred && sm.Flags&FlagSampled == 0 {
+		// The sampling state may only be omitted along with the
+		// parent span ID.
+		w.Set(b3Single, v)
+		return nil
+	}
+	v += "-" + sampled
+	if sm.ParentID != 0 {
+		v += "-" + idToHex(sm.ParentID)
+	}
+	w.Set(b3Single, v)
+	return nil
+}
+
+func b3SingleExtracter(carrier interface{}) (SpanContext, error) {
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var header string
+	err := r.ForeachKey(func(key string, val string) error {
+		if strings.ToLower(key) == b3Single {
+			header = val
+		}
+		return nil
+	})
+	if err != nil {
+		return SpanContext{}, err
+	}
+	return parseB3Single(header)
+}
+
+// parseB3Single parses the value of a b3 header, which has the form
+// {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}, where the last
+// two fields are optional.
+func parseB3Single(header string) (SpanContext, error) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	ctx := SpanContext{Baggage: map[string]string{}}
+	var ok1, ok2 bool
+	ctx.TraceID, ok1 = b3ID(parts[0])
+	ctx.SpanID, ok2 = b3ID(parts[1])
+	if !ok1 || !ok2 || ctx.TraceID == 0 || ctx.SpanID == 0 {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1":
+			ctx.Flags |= FlagSampled
+		case "d":
+			ctx.Flags |= FlagSampled | FlagDebug
+		case "0":
+		default:
+			return SpanContext{}, opentracing.ErrSpanContextNotFound
+		}
+	} else {
+		ctx.deferred = true
+	}
+	if len(parts) > 3 {
+		var ok bool
+		ctx.ParentID, ok = b3ID(parts[3])
+		if !ok {
+			return SpanContext{}, opentracing.ErrSpanContextNotFound
+		}
+	}
+	return ctx, nil
+}
@@ -0,0 +1,278 @@
+package tracer
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/tracer/tracer/pb"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Servers that fail are considered down for a duration that doubles
+// with each consecutive failure, within these bounds.
+const (
+	minDownTime = 1 * time.Second
+	maxDownTime = 1 * time.Minute
+)
+
+// BalancerOptions are options for spreading spans across multiple
+// servers.
+type BalancerOptions struct {
+	// Whether to send all spans of a trace to the same server, as
+	// long as it is up. This is required by servers that make
+	// decisions based on whole traces, such as tail-based samplers.
+	RouteByTrace bool
+	// How often to resolve the addresses again, to pick up changes
+	// to DNS records. Defaults to one minute.
+	ResolveInterval time.Duration
+}
+
+// NewGRPCBalanced returns a new Storer that sends spans via gRPC to
+// multiple servers. Host names that resolve to multiple IP addresses
+// are treated as multiple servers.
+//
+// Batches are spread evenly across all servers, or by trace ID if
+// configured. Servers that fail are avoided for a while, and their
+// batches are sent to the remaining servers. When routing by trace
+// ID, a failed batch may partially have been stored already, in
+// which case retrying it stores some spans twice.
+func NewGRPCBalanced(addresses []string, balOpts *BalancerOptions, grpcOpts *GRPCOptions, opts ...grpc.DialOption) (Storer, error) {
+	if balOpts == nil {
+		balOpts = &BalancerOptions{}
+	}
+	if balOpts.ResolveInterval == 0 {
+		balOpts.ResolveInterval = 1 * time.Minute
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no addresses")
+	}
+	var logger Logger = defaultLogger{}
+	if grpcOpts != nil && grpcOpts.Logger != nil {
+		logger = grpcOpts.Logger
+	}
+	var backends []*grpcBackend
+	for _, addr := range resolveAddresses(addresses, logger) {
+		be, err := dialBackend(addr, opts)
+		if err != nil {
+			for _, be := range backends {
+				_ = be.close()
+			}
+			return nil, err
+		}
+		backends = append(backends, be)
+	}
+	g := &GRPC{
+		backends:        backends,
+		dialOpts:        opts,
+		addresses:       addresses,
+		byTrace:         balOpts.RouteByTrace,
+		resolveInterval: balOpts.ResolveInterval,
+		resolved:        time.Now(),
+	}
+	var err error
+	g.b, err = newBatcher(g, grpcOpts)
+	if err != nil {
+		_ = g.close()
+		return nil, err
+	}
+	go g.b.loop()
+	return g, nil
+}
+
+// resolveAddresses expands host names to all their IP addresses.
+// Addresses that can't be resolved are kept as they are.
+func resolveAddresses(addresses []string, logger Logger) []string {
+	var out []string
+	for _, addr := range addresses {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			out = append(out, addr)
+			continue
+		}
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			logger.Printf("couldn't resolve %s: %s", host, err)
+			out = append(out, addr)
+			continue
+		}
+		for _, ip := range ips {
+			out = append(out, net.JoinHostPort(ip, port))
+		}
+	}
+	return out
+}
+
+// refresh resolves the addresses again if the resolve interval has
+// passed, connecting to new servers and disconnecting from removed
+// ones.
+func (g *GRPC) refresh() {
+	if g.resolveInterval == 0 || time.Since(g.resolved) < g.resolveInterval {
+		return
+	}
+	g.resolved = time.Now()
+	addrs := resolveAddresses(g.addresses, g.b.logger)
+	if len(addrs) == 0 {
+		return
+	}
+	old := map[string]*grpcBackend{}
+	for _, be := range g.backends {
+		old[be.address] = be
+	}
+	var backends []*grpcBackend
+	for _, addr := range addrs {
+		if be, ok := old[addr]; ok {
+			backends = append(backends, be)
+			delete(old, addr)
+			continue
+		}
+		be, err := dialBackend(addr, g.dialOpts)
+		if err != nil {
+			g.b.logger.Printf("couldn't connect to %s: %s", addr, err)
+			continue
+		}
+		backends = append(backends, be)
+	}
+	if len(backends) == 0 {
+		return
+	}
+	for _, be := range old {
+		_ = be.close()
+	}
+	g.backends = backends
+}
+
+func (be *grpcBackend) up() {
+	be.failures = 0
+	be.downUntil = time.Time{}
+}
+
+func (be *grpcBackend) down() {
+	d := minDownTime << uint(be.failures)
+	if d > maxDownTime || d <= 0 {
+		d = maxDownTime
+	}
+	be.failures++
+	be.downUntil = time.Now().Add(d)
+}
+
+func (be *grpcBackend) isDown(now time.Time) bool {
+	return now.Before(be.downUntil)
+}
+
+// candidates returns the backends in the order they should be tried:
+// servers that are up in round-robin order, followed by servers that
+// are down, starting with the one that will be up again soonest.
+func (g *GRPC) candidates() []*grpcBackend {
+	now := time.Now()
+	var up, down []*grpcBackend
+	for i := range g.backends {
+		be := g.backends[(g.next+i)%len(g.backends)]
+		if be.isDown(now) {
+			down = append(down, be)
+		} else {
+			up = append(up, be)
+		}
+	}
+	g.next = (g.next + 1) % len(g.backends)
+	sort.Sort(byDownUntil(down))
+	return append(up, down...)
+}
+
+type byDownUntil []*grpcBackend
+
+func (s byDownUntil) Len() int           { return len(s) }
+func (s byDownUntil) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byDownUntil) Less(i, j int) bool { return s[i].downUntil.Before(s[j].downUntil) }
+
+// store sends a request to one of the servers, failing over to other
+// servers on transient errors.
+func (g *GRPC) store(ctx context.Context, req *pb.StoreRequest) error {
+	g.refresh()
+	if g.byTrace && len(g.backends) > 1 {
+		return g.storeByTrace(ctx, req, len(g.backends))
+	}
+	var err error
+	for _, be := range g.candidates() {
+		err = be.store(ctx, req, g.b.logger)
+		if err == nil {
+			be.up()
+			return nil
+		}
+		if !g.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		be.down()
+	}
+	return err
+}
+
+// storeByTrace splits a request by trace ID and sends each part to the
+// server that owns the traces. If a server fails, its part is split
+// among the remaining servers, up to attempts times.
+func (g *GRPC) storeByTrace(ctx context.Context, req *pb.StoreRequest, attempts int) error {
+	parts := map[*grpcBackend][]*pb.Span{}
+	now := time.Now()
+	for _, sp := range req.Spans {
+		be := g.owner(sp.TraceId, now)
+		parts[be] = append(parts[be], sp)
+	}
+	var errs multiError
+	for be, spans := range parts {
+		part := &pb.StoreRequest{Spans: spans, Processes: req.Processes}
+		err := be.store(ctx, part, g.b.logger)
+		if err == nil {
+			be.up()
+			continue
+		}
+		if g.retryable(err) && ctx.Err() == nil {
+			be.down()
+			if attempts > 1 {
+				err = g.storeByTrace(ctx, part, attempts-1)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errs.err()
+}
+
+// owner returns the server that owns a trace, using rendezvous hashing
+// over all servers that are up. This way, only the traces of servers
+// that go down or come back up are moved to other servers.
+func (g *GRPC) owner(traceID uint64, now time.Time) *grpcBackend {
+	var best *grpcBackend
+	var bestScore uint64
+	for _, onlyUp := range []bool{true, false} {
+		for _, be := range g.backends {
+			if onlyUp && be.isDown(now) {
+				continue
+			}
+			if score := mix64(traceID ^ be.hash); best == nil || score > bestScore {
+				best, bestScore = be, score
+			}
+		}
+		if best != nil {
+			break
+		}
+	}
+	return best
+}
+
+// mix64 is the finalizer of SplitMix64. It scrambles the bits of x,
+// so that similar inputs result in very different outputs.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
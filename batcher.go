@@ -0,0 +1,609 @@
+package tracer
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrStorerClosed is returned when using a storer that has been
+// closed.
+var ErrStorerClosed = errors.New("storer is closed")
+
+// QueuePolicy determines what a storer does with new spans when its
+// buffer is full.
+type QueuePolicy int
+
+const (
+	// DropNewest drops the new span.
+	DropNewest QueuePolicy = iota
+	// DropOldest drops the oldest buffered span to make room for the
+	// new one.
+	DropOldest
+	// Block blocks the caller until there is room for the new span,
+	// or until the block timeout expires, in which case the new span
+	// is dropped.
+	Block
+)
+
+// A batchSender sends batches of spans to a server, on behalf of a
+// batcher. Except for encode, its methods are only called from the
+// batcher's sending goroutine.
+type batchSender interface {
+	// encode converts a span to the sender's representation and
+	// returns it together with its encoded size in bytes. It may be
+	// called concurrently.
+	encode(sp RawSpan) (interface{}, int, error)
+	// send sends a batch of encoded spans.
+	send(ctx context.Context, batch []interface{}) error
+	// marshal serializes a batch of encoded spans, so that it can be
+	// spooled.
+	marshal(batch []interface{}) ([]byte, error)
+	// sendMarshaled sends a batch that was serialized by marshal.
+	sendMarshaled(ctx context.Context, b []byte) error
+	// retryable reports whether sending a batch may succeed if tried
+	// again.
+	retryable(err error) bool
+	// close releases the sender's resources.
+	close() error
+}
+
+// permanentError wraps errors that retrying won't fix.
+type permanentError struct {
+	error
+}
+
+// batcher implements queueing, batching, retries and spooling for
+// storers that send spans to a server.
+//
+// Two goroutines do the work: loop accepts spans and groups them into
+// batches, and sendLoop encodes and sends the batches. This way, slow
+// encoding or sending doesn't hold up accepting spans until the
+// buffers run full.
+type batcher struct {
+	// The number of spans that were dropped since the last flush,
+	// accessed atomically.
+	lost int64
+
+	sender        batchSender
+	queue         []RawSpan
+	queueSize     int
+	maxBatchBytes int
+	ch            chan RawSpan
+	policy        QueuePolicy
+	blockTimeout  time.Duration
+	flushCh       chan chan error
+	closeCh       chan chan error
+	done          chan struct{}
+	flushInterval time.Duration
+	logger        Logger
+
+	// closeMu guards closed, so that no span can be queued once
+	// Close has started draining the queue.
+	closeMu sync.RWMutex
+	closed  bool
+
+	// Batches are handed from loop to sendLoop via jobs, and their
+	// slices are recycled via free.
+	jobs chan batchJob
+	free chan []RawSpan
+	// The context of all sends. It is canceled when closing times
+	// out, which aborts the current send and its retries.
+	sendCtx    context.Context
+	cancelSend context.CancelFunc
+	// Buffers for encoded spans, only used by sendLoop.
+	items []interface{}
+	sizes []int
+	// The last error of sending spans in the background since the
+	// last flush, only used by sendLoop.
+	sendErr error
+
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	spool          *spool
+
+	metrics *batcherMetrics
+}
+
+// A batchJob is a batch of spans that loop hands to sendLoop.
+type batchJob struct {
+	spans []RawSpan
+	// If not nil, receives the result of sending the batch and of
+	// replaying spooled batches.
+	done chan error
+	// If not nil, the batcher closes after sending the batch, and
+	// sends the result to close.
+	close chan error
+}
+
+// minSpansPerEncoder is the smallest number of spans that is worth
+// encoding in a goroutine of its own.
+const minSpansPerEncoder = 256
+
+// newBatcher returns a batcher that sends spans with s. Zero options
+// take their defaults; opts itself isn't modified. The caller has to
+// start the batcher's goroutine by calling loop.
+func newBatcher(s batchSender, grpcOpts *GRPCOptions) (*batcher, error) {
+	opts := &GRPCOptions{MaxRetries: 3}
+	if grpcOpts != nil {
+		*opts = *grpcOpts
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 1 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = defaultLogger{}
+	}
+	if opts.MaxBatchBytes <= 0 {
+		opts.MaxBatchBytes = 1024 * 1024
+	}
+	if opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = 100 * time.Millisecond
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	metrics, err := newBatcherMetrics(opts.Registerer, opts.ConstLabels, opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+	var sp *spool
+	if opts.SpoolDir != "" {
+		size := opts.SpoolSize
+		if size <= 0 {
+			size = 64 * 1024 * 1024
+		}
+		sp, err = openSpool(opts.SpoolDir, size)
+		if err != nil {
+			metrics.unregister()
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &batcher{
+		sender:        s,
+		queue:         make([]RawSpan, 0, opts.QueueSize),
+		queueSize:     opts.QueueSize,
+		maxBatchBytes: opts.MaxBatchBytes,
+		ch:            make(chan RawSpan, opts.QueueSize*2),
+		policy:        opts.QueuePolicy,
+		blockTimeout:  opts.BlockTimeout,
+		flushCh:       make(chan chan error),
+		closeCh:       make(chan chan error, 1),
+		done:          make(chan struct{}),
+		flushInterval: opts.FlushInterval,
+		logger:        opts.Logger,
+
+		jobs:       make(chan batchJob, 1),
+		free:       make(chan []RawSpan, 2),
+		sendCtx:    ctx,
+		cancelSend: cancel,
+
+		maxRetries:     opts.MaxRetries,
+		initialBackoff: opts.InitialBackoff,
+		maxBackoff:     opts.MaxBackoff,
+		spool:          sp,
+
+		metrics: metrics,
+	}
+	return b, nil
+}
+
+func (b *batcher) loop() {
+	go b.sendLoop()
+	t := time.NewTicker(b.flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case sp := <-b.ch:
+			b.queue = append(b.queue, sp)
+			if len(b.queue) >= b.queueSize {
+				// This blocks while sendLoop is busy, which
+				// lets b.ch fill up and the queue policy apply.
+				b.jobs <- batchJob{spans: b.takeQueue()}
+			}
+		case <-t.C:
+			if len(b.queue) == 0 && b.spool == nil {
+				break
+			}
+			select {
+			case b.jobs <- batchJob{spans: b.queue}:
+				b.takeQueue()
+			default:
+				// sendLoop is busy, the spans will be sent with
+				// the next batch.
+			}
+		case ch := <-b.flushCh:
+			b.drain()
+			b.jobs <- batchJob{spans: b.takeQueue(), done: ch}
+		case ch := <-b.closeCh:
+			// Close has stopped Store from queueing spans, so
+			// draining b.ch collects all of them.
+			b.drain()
+			b.jobs <- batchJob{spans: b.takeQueue(), close: ch}
+			b.metrics.queueLength.Set(0)
+			return
+		}
+		b.metrics.queueLength.Set(float64(len(b.queue) + len(b.ch)))
+	}
+}
+
+// drain moves the spans that are waiting in b.ch to the queue. Spans
+// that are stored meanwhile are left for later.
+func (b *batcher) drain() {
+	for n := len(b.ch); n > 0; n-- {
+		select {
+		case sp := <-b.ch:
+			b.queue = append(b.queue, sp)
+		default:
+			// DropOldest took the remaining spans.
+			return
+		}
+	}
+}
+
+// takeQueue returns the queued spans and replaces the queue with an
+// empty one.
+func (b *batcher) takeQueue() []RawSpan {
+	spans := b.queue
+	select {
+	case b.queue = <-b.free:
+	default:
+		b.queue = make([]RawSpan, 0, b.queueSize)
+	}
+	return spans
+}
+
+// sendLoop sends the batches that loop hands to it, in order.
+func (b *batcher) sendLoop() {
+	for job := range b.jobs {
+		// Closing doesn't wait for the whole spool to be
+		// replayed; it is picked up by the next process.
+		err := b.flush(b.sendCtx, job.spans, job.close == nil)
+		// Recycle the batch, without holding on to its spans.
+		for i := range job.spans {
+			job.spans[i] = RawSpan{}
+		}
+		select {
+		case b.free <- job.spans[:0]:
+		default:
+		}
+
+		switch {
+		case job.close != nil:
+			if cerr := b.sender.close(); err == nil {
+				err = cerr
+			}
+			b.cancelSend()
+			b.metrics.unregister()
+			job.close <- b.withLosses(err)
+			return
+		case job.done != nil:
+			job.done <- b.withLosses(err)
+		case err != nil:
+			b.logger.Printf("couldn't flush spans: %s", err)
+			b.sendErr = err
+		}
+	}
+}
+
+// withLosses adds the last error of sending spans in the background,
+// and the number of spans dropped, since the last flush to err, the
+// result of a flush.
+func (b *batcher) withLosses(err error) error {
+	var errs multiError
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if b.sendErr != nil {
+		errs = append(errs, b.sendErr)
+		b.sendErr = nil
+	}
+	if n := atomic.SwapInt64(&b.lost, 0); n > 0 {
+		errs = append(errs, fmt.Errorf("dropped %d spans", n))
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errs.err()
+}
+
+// drop records that n spans were dropped.
+func (b *batcher) drop(n int) {
+	atomic.AddInt64(&b.lost, int64(n))
+	b.metrics.dropped.Add(float64(n))
+}
+
+// flush encodes and sends spans, in as many batches as their size
+// requires, and replays spooled batches; see replay for the meaning
+// of more.
+func (b *batcher) flush(ctx context.Context, spans []RawSpan, more bool) error {
+	b.encode(spans)
+	var errs multiError
+	var batch []interface{}
+	batchBytes := 0
+	for i, item := range b.items {
+		if item == nil {
+			continue
+		}
+		n := b.sizes[i]
+		if batchBytes+n > b.maxBatchBytes {
+			if err := b.sendBatch(ctx, batch, batchBytes); err != nil {
+				errs = append(errs, err)
+			}
+			batch, batchBytes = nil, 0
+		}
+		batch = append(batch, item)
+		batchBytes += n
+	}
+	if len(batch) > 0 {
+		if err := b.sendBatch(ctx, batch, batchBytes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := b.replay(ctx, more); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errs.err()
+}
+
+// encode encodes spans into b.items and their sizes into b.sizes.
+// Large batches are encoded in parallel. Spans that can't be encoded,
+// or that exceed the maximum batch size on their own, are dropped,
+// leaving a nil item.
+func (b *batcher) encode(spans []RawSpan) {
+	for i := range b.items {
+		b.items[i] = nil
+	}
+	if cap(b.items) < len(spans) {
+		b.items = make([]interface{}, len(spans))
+		b.sizes = make([]int, len(spans))
+	}
+	b.items = b.items[:len(spans)]
+	b.sizes = b.sizes[:len(spans)]
+
+	encoders := len(spans) / minSpansPerEncoder
+	if n := runtime.GOMAXPROCS(0); encoders > n {
+		encoders = n
+	}
+	if encoders <= 1 {
+		b.encodeRange(spans, 0, len(spans))
+		return
+	}
+	var wg sync.WaitGroup
+	per := (len(spans) + encoders - 1) / encoders
+	for lo := 0; lo < len(spans); lo += per {
+		hi := lo + per
+		if hi > len(spans) {
+			hi = len(spans)
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			b.encodeRange(spans, lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+}
+
+func (b *batcher) encodeRange(spans []RawSpan, lo, hi int) {
+	for i := lo; i < hi; i++ {
+		item, n, err := b.sender.encode(spans[i])
+		if err != nil {
+			b.drop(1)
+			b.logger.Printf("dropping span because of error: %s", err)
+			continue
+		}
+		if n > b.maxBatchBytes {
+			b.drop(1)
+			b.logger.Printf("dropping span of %d bytes, which exceeds the maximum batch size", n)
+			continue
+		}
+		b.items[i], b.sizes[i] = item, n
+	}
+}
+
+// sendBatch sends a batch of encoded spans, spooling it if that fails.
+func (b *batcher) sendBatch(ctx context.Context, batch []interface{}, batchBytes int) error {
+	b.metrics.batchSpans.Observe(float64(len(batch)))
+	b.metrics.batchBytes.Observe(float64(batchBytes))
+	start := time.Now()
+	err := b.send(ctx, batch)
+	b.metrics.flushDuration.Observe(time.Since(start).Seconds())
+	if err == nil {
+		return nil
+	}
+	if b.spool == nil || !b.retryable(err) {
+		b.drop(len(batch))
+		return err
+	}
+	if err2 := b.spoolBatch(batch); err2 != nil {
+		b.drop(len(batch))
+		return fmt.Errorf("%s; couldn't spool spans: %s", err, err2)
+	}
+	return fmt.Errorf("%s; spooled %d spans", err, len(batch))
+}
+
+// send sends a batch, retrying with exponential backoff on transient
+// errors.
+func (b *batcher) send(ctx context.Context, batch []interface{}) error {
+	backoff := b.initialBackoff
+	for i := 0; ; i++ {
+		err := b.sender.send(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		b.metrics.sendErrors.Inc()
+		if i >= b.maxRetries || !b.retryable(err) {
+			return err
+		}
+		b.metrics.retries.Inc()
+		// Sleep for a random duration in [backoff/2, backoff).
+		select {
+		case <-time.After(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > b.maxBackoff {
+			backoff = b.maxBackoff
+		}
+	}
+}
+
+func (b *batcher) retryable(err error) bool {
+	if _, ok := err.(permanentError); ok {
+		return false
+	}
+	return b.sender.retryable(err)
+}
+
+func (b *batcher) spoolBatch(batch []interface{}) error {
+	data, err := b.sender.marshal(batch)
+	if err != nil {
+		return err
+	}
+	discarded, err := b.spool.push(data)
+	if discarded > 0 {
+		b.logger.Printf("spool full, dropped %d batches", discarded)
+	}
+	return err
+}
+
+// replay sends spooled batches, oldest first. So that a large spool
+// doesn't hold up live spans, it sends a single batch, and only sends
+// more if more is true and no batch of live spans is waiting. It stops
+// when sending fails; batches are only tried once per flush.
+func (b *batcher) replay(ctx context.Context, more bool) error {
+	if b.spool == nil {
+		return nil
+	}
+	for first := true; b.spool.len() > 0; first = false {
+		if !first && (!more || len(b.jobs) > 0) {
+			return nil
+		}
+		data, err := b.spool.peek()
+		if err != nil {
+			// Retrying won't make the batch readable, and it
+			// would hold up all batches after it.
+			b.logger.Printf("dropping unreadable spooled batch: %s", err)
+			if err := b.spool.pop(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := b.sender.sendMarshaled(ctx, data); err != nil {
+			b.metrics.sendErrors.Inc()
+			if b.retryable(err) {
+				return err
+			}
+			b.logger.Printf("dropping spooled batch because of error: %s", err)
+		}
+		if err := b.spool.pop(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store queues a span, applying the queue policy if the buffer is
+// full.
+func (b *batcher) Store(sp RawSpan) error {
+	b.closeMu.RLock()
+	defer b.closeMu.RUnlock()
+	if b.closed {
+		b.metrics.dropped.Inc()
+		return ErrStorerClosed
+	}
+	select {
+	case b.ch <- sp:
+		b.metrics.stored.Inc()
+		return nil
+	default:
+	}
+
+	switch b.policy {
+	case DropOldest:
+		select {
+		case <-b.ch:
+			b.drop(1)
+		default:
+		}
+		select {
+		case b.ch <- sp:
+			b.metrics.stored.Inc()
+		default:
+			b.drop(1)
+		}
+	case Block:
+		t := time.NewTimer(b.blockTimeout)
+		defer t.Stop()
+		select {
+		case b.ch <- sp:
+			b.metrics.stored.Inc()
+		case <-t.C:
+			b.drop(1)
+		}
+	default:
+		b.drop(1)
+	}
+	return nil
+}
+
+// Flush sends all queued spans. Besides errors of sending them, it
+// reports errors of sending spans in the background and spans that
+// were dropped since the last flush.
+func (b *batcher) Flush() error {
+	ch := make(chan error)
+	select {
+	case b.flushCh <- ch:
+		return <-ch
+	case <-b.done:
+		return ErrStorerClosed
+	}
+}
+
+// Close sends all buffered spans, stops the background goroutine and
+// closes the sender. If ctx expires first, the current send is
+// aborted, the remaining spans are spooled if possible, and Close
+// returns ctx's error. Like Flush, it reports spans that were lost
+// since the last flush. Closing an already closed batcher does
+// nothing.
+func (b *batcher) Close(ctx context.Context) error {
+	b.closeMu.Lock()
+	if b.closed {
+		b.closeMu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.closeMu.Unlock()
+
+	ch := make(chan error, 1)
+	// closeCh is buffered, so this doesn't wait for loop, which may
+	// be blocked on a send.
+	b.closeCh <- ch
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		b.cancelSend()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,256 @@
+package tracer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+)
+
+// fakeSender records the batches it is asked to send. Spans are
+// encoded as their span IDs, with a size of 100 bytes.
+// If block is set, sends block until their context is canceled. If
+// err is set, sends fail with it.
+type fakeSender struct {
+	mu      sync.Mutex
+	batches [][]interface{}
+	block   bool
+	err     error
+	// The number of spooled batches that were sent.
+	replayed int
+}
+
+func (s *fakeSender) encode(sp RawSpan) (interface{}, int, error) {
+	return sp.SpanID, 100, nil
+}
+
+func (s *fakeSender) send(ctx context.Context, batch []interface{}) error {
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]interface{}(nil), batch...))
+	return nil
+}
+
+func (s *fakeSender) marshal(batch []interface{}) ([]byte, error) { return nil, nil }
+func (s *fakeSender) sendMarshaled(ctx context.Context, b []byte) error {
+	s.replayed++
+	return nil
+}
+func (s *fakeSender) retryable(err error) bool { return false }
+func (s *fakeSender) close() error             { return nil }
+
+func TestBatcher(t *testing.T) {
+	const n = 2000
+	s := &fakeSender{}
+	b, err := newBatcher(s, &GRPCOptions{
+		QueueSize:     n,
+		FlushInterval: time.Hour,
+		MaxBatchBytes: 100 * 300,
+		QueuePolicy:   Block,
+		BlockTimeout:  time.Second,
+		Registerer:    prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	go b.loop()
+	for i := uint64(1); i <= n; i++ {
+		if err := b.Store(RawSpan{SpanContext: SpanContext{SpanID: i}}); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	}
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	next := uint64(1)
+	for _, batch := range s.batches {
+		if len(batch) > 300 {
+			t.Errorf("got batch of %d spans, want at most 300", len(batch))
+		}
+		for _, item := range batch {
+			if item.(uint64) != next {
+				t.Fatalf("got span %d, want %d", item, next)
+			}
+			next++
+		}
+	}
+	if next != n+1 {
+		t.Errorf("got %d spans, want %d", next-1, n)
+	}
+}
+
+func TestBatcherCloseTimeout(t *testing.T) {
+	s := &fakeSender{block: true}
+	b, err := newBatcher(s, &GRPCOptions{
+		QueueSize:      10,
+		FlushInterval:  time.Hour,
+		MaxRetries:     100,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Registerer:     prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	go b.loop()
+	// Enough spans to block both the send goroutine and loop.
+	for i := uint64(1); i <= 40; i++ {
+		b.Store(RawSpan{SpanContext: SpanContext{SpanID: i}})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := b.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %s despite its deadline", d)
+	}
+	if err := b.Store(RawSpan{}); err != ErrStorerClosed {
+		t.Errorf("got error %v after Close, want %v", err, ErrStorerClosed)
+	}
+}
+
+func TestBatcherDropped(t *testing.T) {
+	s := &fakeSender{err: errors.New("rejected")}
+	b, err := newBatcher(s, &GRPCOptions{
+		QueueSize:     10,
+		FlushInterval: time.Hour,
+		Registerer:    prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	go b.loop()
+	for i := uint64(1); i <= 3; i++ {
+		b.Store(RawSpan{SpanContext: SpanContext{SpanID: i}})
+	}
+	if err := b.Close(context.Background()); err == nil {
+		t.Error("expected error from failing sender")
+	}
+	var m dto.Metric
+	if err := b.metrics.dropped.Write(&m); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if got := m.GetCounter().GetValue(); got != 3 {
+		t.Errorf("got %v dropped spans, want 3", got)
+	}
+}
+
+func TestBatcherDefaults(t *testing.T) {
+	opts := &GRPCOptions{Registerer: prometheus.NewRegistry()}
+	want := *opts
+	b, err := newBatcher(&fakeSender{}, opts)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	go b.loop()
+	if err := b.Close(context.Background()); err != nil {
+		t.Error("unexpected error: ", err)
+	}
+	if !reflect.DeepEqual(*opts, want) {
+		t.Errorf("options were modified: %+v", opts)
+	}
+}
+
+func TestBatcherLosses(t *testing.T) {
+	s := &fakeSender{err: errors.New("rejected")}
+	b, err := newBatcher(s, &GRPCOptions{
+		QueueSize:     2,
+		FlushInterval: time.Hour,
+		Registerer:    prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	go b.loop()
+	defer b.Close(context.Background())
+	// A full queue is sent in the background.
+	for i := uint64(1); i <= 2; i++ {
+		b.Store(RawSpan{SpanContext: SpanContext{SpanID: i}})
+	}
+	if err := b.Flush(); err == nil || !strings.Contains(err.Error(), "dropped 2 spans") {
+		t.Errorf("got error %v, want report of failed background send", err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Errorf("got error %v, want losses to be reported only once", err)
+	}
+}
+
+func TestBatcherReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracer-spool")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	defer os.RemoveAll(dir)
+	s := &fakeSender{}
+	b, err := newBatcher(s, &GRPCOptions{
+		QueueSize:     10,
+		FlushInterval: time.Hour,
+		SpoolDir:      dir,
+		Registerer:    prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := b.spool.push([]byte("batch")); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	}
+
+	// A live batch is waiting, so only one spooled batch is sent.
+	b.jobs <- batchJob{}
+	if err := b.replay(context.Background(), true); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if s.replayed != 1 {
+		t.Errorf("got %d replayed batches while a live batch was waiting, want 1", s.replayed)
+	}
+	<-b.jobs
+	if err := b.replay(context.Background(), false); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if s.replayed != 2 {
+		t.Errorf("got %d replayed batches, want 2", s.replayed)
+	}
+	if err := b.replay(context.Background(), true); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if s.replayed != 4 || b.spool.len() != 0 {
+		t.Errorf("got %d replayed and %d spooled batches when idle, want 4 and 0", s.replayed, b.spool.len())
+	}
+
+	// An unreadable batch doesn't hold up the ones after it.
+	for i := 0; i < 2; i++ {
+		if _, err := b.spool.push([]byte("batch")); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, b.spool.files[0].name)); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if err := b.replay(context.Background(), true); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if s.replayed != 5 || b.spool.len() != 0 {
+		t.Errorf("got %d replayed and %d spooled batches after an unreadable one, want 5 and 0", s.replayed, b.spool.len())
+	}
+}
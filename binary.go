@@ -0,0 +1,280 @@
+package tracer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// The binary format starts with a magic value followed by a version
+// byte. Version 1 is followed by the trace ID, span ID, parent ID,
+// flags and number of baggage items, all encoded as uvarints. Each
+// baggage item is encoded as the uvarint length of the key, the key,
+// the uvarint length of the value and the value.
+//
+// Earlier versions of Tracer used an unversioned format that starts
+// directly with the 8 byte trace ID. Span contexts in that format can
+// still be extracted. The magic value can't be mistaken for one of
+// them, because it would be the invalid trace ID 0.
+const (
+	binaryMagic   = "\x00\x00\x00\x00\x00\x00\x00\x00"
+	binaryVersion = 1
+)
+
+// Limits on the baggage that will be extracted from the binary
+// formats. Baggage items beyond them are dropped; the rest of the span
+// context is kept. Span contexts with strings that can't fit the size
+// limit on their own, or with more than maxBinaryBaggageRead bytes of
+// baggage in total, are rejected as corrupted, so that extracting
+// never reads more than that.
+const (
+	maxBinaryBaggageItems = 64
+	maxBinaryBaggageSize  = 8 * 1024
+	maxBinaryBaggageRead  = 8 * maxBinaryBaggageSize
+)
+
+func binaryInjecter(sm SpanContext, carrier interface{}) error {
+	w, ok := carrier.(io.Writer)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	b := make([]byte, 0, len(binaryMagic)+1+5*binary.MaxVarintLen64)
+	b = append(b, binaryMagic...)
+	b = append(b, binaryVersion)
+	b = appendUvarint(b, sm.TraceID)
+	b = appendUvarint(b, sm.SpanID)
+	b = appendUvarint(b, sm.ParentID)
+	b = appendUvarint(b, sm.Flags)
+	b = appendUvarint(b, uint64(len(sm.Baggage)))
+	for k, v := range sm.Baggage {
+		b = appendUvarint(b, uint64(len(k)))
+		b = append(b, k...)
+		b = appendUvarint(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(b, buf[:n]...)
+}
+
+// byteReader turns an io.Reader into an io.ByteReader without
+// reading more bytes than requested.
+type byteReader struct {
+	r io.Reader
+	b [1]byte
+}
+
+func (r *byteReader) Read(b []byte) (int, error) {
+	return r.r.Read(b)
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(r.r, r.b[:])
+	return r.b[0], err
+}
+
+type binaryReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func binaryExtracter(carrier interface{}) (SpanContext, error) {
+	r, ok := carrier.(io.Reader)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return SpanContext{}, opentracing.ErrSpanContextNotFound
+		}
+		return SpanContext{}, err
+	}
+	if string(magic) != binaryMagic {
+		return legacyBinaryExtracter(io.MultiReader(bytes.NewReader(magic), r))
+	}
+
+	br, ok := r.(binaryReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	version, err := br.ReadByte()
+	if err != nil {
+		return SpanContext{}, binaryError(err)
+	}
+	if version != binaryVersion {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	ctx := SpanContext{Baggage: map[string]string{}}
+	var n uint64
+	for _, x := range []*uint64{&ctx.TraceID, &ctx.SpanID, &ctx.ParentID, &ctx.Flags, &n} {
+		*x, err = binary.ReadUvarint(br)
+		if err != nil {
+			return SpanContext{}, binaryError(err)
+		}
+	}
+	var lim baggageLimiter
+	for i := uint64(0); i < n; i++ {
+		kl, err := binary.ReadUvarint(br)
+		if err != nil {
+			return SpanContext{}, binaryError(err)
+		}
+		k, err := lim.readString(br, kl)
+		if err != nil {
+			return SpanContext{}, err
+		}
+		vl, err := binary.ReadUvarint(br)
+		if err != nil {
+			return SpanContext{}, binaryError(err)
+		}
+		v, err := lim.readString(br, vl)
+		if err != nil {
+			return SpanContext{}, err
+		}
+		lim.add(ctx.Baggage, k, v)
+	}
+	if ctx.TraceID == 0 {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	return ctx, nil
+}
+
+// baggageLimiter enforces the limits on extracted baggage. Strings
+// that exceed the remaining size are discarded, and so are the items
+// they belong to.
+type baggageLimiter struct {
+	items   int
+	size    uint64
+	pending uint64
+	dropped bool
+	// The number of bytes read, counting each string's length as one
+	// byte, so that empty strings count, too.
+	total uint64
+}
+
+// readString reads a string of length l from r, or discards it if it
+// exceeds the limits, in which case it marks the current item as
+// dropped. Strings that can't be valid, because they are larger than
+// the size limit, or that exceed the total amount of baggage that is
+// read, make the span context corrupted.
+func (lim *baggageLimiter) readString(r io.Reader, l uint64) (string, error) {
+	if l > maxBinaryBaggageSize {
+		return "", opentracing.ErrSpanContextCorrupted
+	}
+	lim.total += 1 + l
+	if lim.total > maxBinaryBaggageRead {
+		return "", opentracing.ErrSpanContextCorrupted
+	}
+	if lim.dropped || lim.items >= maxBinaryBaggageItems || l > maxBinaryBaggageSize-lim.size-lim.pending {
+		lim.dropped = true
+		if _, err := io.CopyN(ioutil.Discard, r, int64(l)); err != nil {
+			return "", binaryError(err)
+		}
+		return "", nil
+	}
+	lim.pending += l
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", binaryError(err)
+	}
+	return string(b), nil
+}
+
+// add adds the item that was just read to baggage, unless it was
+// dropped.
+func (lim *baggageLimiter) add(baggage map[string]string, k, v string) {
+	if lim.dropped {
+		lim.dropped = false
+		lim.pending = 0
+		return
+	}
+	lim.items++
+	lim.size += lim.pending
+	lim.pending = 0
+	baggage[k] = v
+}
+
+func binaryError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return opentracing.ErrSpanContextCorrupted
+	}
+	return err
+}
+
+func legacyBinaryInjecter(sm SpanContext, carrier interface{}) error {
+	w, ok := carrier.(io.Writer)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	b := make([]byte, 8*5)
+	binary.BigEndian.PutUint64(b, sm.TraceID)
+	binary.BigEndian.PutUint64(b[8:], sm.SpanID)
+	binary.BigEndian.PutUint64(b[16:], sm.ParentID)
+	binary.BigEndian.PutUint64(b[24:], sm.Flags)
+	binary.BigEndian.PutUint64(b[32:], uint64(len(sm.Baggage)))
+	for k, v := range sm.Baggage {
+		b2 := make([]byte, 16+len(k)+len(v))
+		binary.BigEndian.PutUint64(b2, uint64(len(k)))
+		binary.BigEndian.PutUint64(b2[8:], uint64(len(v)))
+		copy(b2[16:], k)
+		copy(b2[16+len(k):], v)
+		b = append(b, b2...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func legacyBinaryExtracter(carrier interface{}) (SpanContext, error) {
+	r, ok := carrier.(io.Reader)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	ctx := SpanContext{Baggage: map[string]string{}}
+	b := make([]byte, 8*5)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return SpanContext{}, opentracing.ErrSpanContextNotFound
+		}
+		return SpanContext{}, err
+	}
+	ctx.TraceID = binary.BigEndian.Uint64(b)
+	ctx.SpanID = binary.BigEndian.Uint64(b[8:])
+	ctx.ParentID = binary.BigEndian.Uint64(b[16:])
+	ctx.Flags = binary.BigEndian.Uint64(b[24:])
+	n := binary.BigEndian.Uint64(b[32:])
+
+	var lim baggageLimiter
+	for i := uint64(0); i < n; i++ {
+		if _, err := io.ReadFull(r, b[:16]); err != nil {
+			if err == io.ErrUnexpectedEOF || err == io.EOF {
+				return SpanContext{}, opentracing.ErrSpanContextNotFound
+			}
+			return SpanContext{}, err
+		}
+		kl := binary.BigEndian.Uint64(b)
+		vl := binary.BigEndian.Uint64(b[8:])
+		if kl == 0 {
+			return SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+		k, err := lim.readString(r, kl)
+		if err != nil {
+			return SpanContext{}, err
+		}
+		v, err := lim.readString(r, vl)
+		if err != nil {
+			return SpanContext{}, err
+		}
+		lim.add(ctx.Baggage, k, v)
+	}
+
+	return ctx, nil
+}
@@ -6,10 +6,12 @@ import (
 	"time"
 
 	"github.com/tracer/tracer"
+	"github.com/tracer/tracer/tracerutil"
 
 	_ "github.com/lib/pq"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
@@ -46,7 +48,7 @@ func main() {
 	s4 := t2.StartSpan("mysql", opentracing.ChildOf(s3.Context()))
 	ext.SpanKindRPCClient.Set(s4)
 	ext.Component.Set(s4, "mysql")
-	s4.SetTag("sql.query", "SELECT * FROM table1")
+	s4.SetTag("sql.query", tracerutil.SQLComment(s4, "SELECT * FROM table1"))
 	// The MySQL server is not instrumented, so we only get the client
 	// span.
 	s4.Finish()
@@ -81,7 +83,11 @@ func main() {
 	ext.HTTPStatusCode.Set(s1, 200)
 	s1.Finish()
 
-	// Wait for spans to be flushed. Production code wouldn't need
-	// this.
-	time.Sleep(2 * time.Second)
+	// Send the remaining spans before exiting. Both tracers share the
+	// storer, so closing one of them suffices.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t1.Close(ctx); err != nil {
+		log.Println(err)
+	}
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tracer/tracer"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// importFiles sends the spans in files written by tracer.File to a
+// server's gRPC storage transport. It exits with a non-zero status if
+// any file couldn't be imported completely.
+func importFiles(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	server := fs.String("s", "localhost:9999", "`address` of the server's gRPC storage transport")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: tracer-cli import [-s address] file...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Importing has no latency requirements, so block instead of
+	// dropping spans when the server can't keep up.
+	storage, err := tracer.NewGRPC(*server, &tracer.GRPCOptions{
+		QueueSize:      1024,
+		FlushInterval:  1 * time.Second,
+		QueuePolicy:    tracer.Block,
+		BlockTimeout:   1 * time.Minute,
+		MaxRetries:     5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}, grpc.WithInsecure())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	n, failed := 0, false
+	for _, path := range fs.Args() {
+		m, err := importFile(storage, path)
+		// Storing only queues the spans; flushing reports whether
+		// they were sent, or dropped.
+		if ferr := storage.(tracer.Flusher).Flush(); err == nil {
+			err = ferr
+		}
+		if err != nil {
+			log.Printf("%s: %s", path, err)
+			failed = true
+			continue
+		}
+		n += m
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+	if err := storage.(tracer.Closer).Close(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("imported %d spans", n)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func importFile(storage tracer.Storer, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var sp tracer.RawSpan
+		if err := json.Unmarshal(sc.Bytes(), &sp); err != nil {
+			log.Printf("%s:%d: skipping invalid span: %s", path, line, err)
+			continue
+		}
+		if err := storage.Store(sp); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, sc.Err()
+}
@@ -1,4 +1,7 @@
 // Command tracer-cli provides a CLI query client.
+//
+// "tracer-cli import file..." imports spans from files written by
+// tracer.File.
 package main
 
 import (
@@ -21,10 +24,21 @@ func init() {
 
 func main() {
 	flag.Parse()
+	if flag.Arg(0) == "import" {
+		importFiles(flag.Args()[1:])
+		return
+	}
 	q := client.NewQueryClient(fHost)
 	num, err := strconv.ParseUint(os.Args[1], 16, 64)
 	if err != nil {
-		log.Fatalln("Invalid ID:", err)
+		// Also accept queries from database logs that contain
+		// comments injected with the tracer.SQLComment format.
+		var tr tracer.Tracer
+		ctx, err2 := tr.Extract(tracer.SQLComment, &tracer.SQLCommentCarrier{Query: os.Args[1]})
+		if err2 != nil {
+			log.Fatalln("Invalid ID:", err)
+		}
+		num = ctx.(tracer.SpanContext).TraceID
 	}
 	trace, err := q.TraceByID(num)
 	if err != nil {
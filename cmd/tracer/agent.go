@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tracer/tracer"
+	"github.com/tracer/tracer/internal/pbutil"
+	"github.com/tracer/tracer/pb"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// agent runs Tracer as an agent. The agent receives spans from
+// tracer.UDP on the local host, batches them and forwards them to a
+// collector via gRPC.
+func agent(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:9996", "UDP `address` to receive spans on")
+	collector := fs.String("collector", "localhost:9999", "`address` of the collector's gRPC storage transport")
+	spool := fs.String("spool", "", "`directory` for spooling spans while the collector is unreachable")
+	_ = fs.Parse(args)
+
+	opts := &tracer.GRPCOptions{
+		QueueSize:      1024,
+		FlushInterval:  1 * time.Second,
+		MaxRetries:     3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		SpoolDir:       *spool,
+	}
+	storage, err := tracer.NewGRPC(*collector, opts, grpc.WithInsecure())
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+		<-ch
+		_ = conn.Close()
+	}()
+
+	buf := make([]byte, 65536)
+	processes := processCache{}
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			break
+		}
+		req := &pb.StoreRequest{}
+		if err := proto.Unmarshal(buf[:n], req); err != nil {
+			log.Println("dropping invalid datagram:", err)
+			continue
+		}
+		spans, err := pbutil.RawSpans(req)
+		if err != nil {
+			log.Println("dropping invalid datagram:", err)
+			continue
+		}
+		for _, sp := range spans {
+			sp.Process = processes.intern(sp.Process)
+			_ = storage.Store(sp)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := storage.(tracer.Closer).Close(ctx); err != nil {
+		log.Println("couldn't send remaining spans:", err)
+	}
+}
+
+// maxCachedProcesses limits the size of a processCache. Processes
+// come and go as programs restart, so old entries are eventually
+// discarded.
+const maxCachedProcesses = 1024
+
+// processCache maps equal processes to a single tracer.Process, so
+// that spans of the same process that arrived in separate datagrams
+// share their process again when they are forwarded in a batch.
+type processCache map[string]*tracer.Process
+
+func (c processCache) intern(p *tracer.Process) *tracer.Process {
+	if p == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+	key := strings.Join(keys, "\x00")
+	if cached, ok := c[key]; ok {
+		return cached
+	}
+	if len(c) >= maxCachedProcesses {
+		for k := range c {
+			delete(c, k)
+		}
+	}
+	c[key] = p
+	return p
+}
@@ -1,4 +1,8 @@
 // Command tracer is the Tracer query and storage server.
+//
+// Run as "tracer agent", it instead receives spans via UDP on the
+// local host and forwards them to a server. See "tracer agent -h" for
+// its flags.
 package main
 
 import (
@@ -82,6 +86,10 @@ func init() {
 
 func main() {
 	flag.Parse()
+	if flag.Arg(0) == "agent" {
+		agent(flag.Args()[1:])
+		return
+	}
 
 	f, err := os.Open(fConfig)
 	if err != nil {
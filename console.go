@@ -0,0 +1,206 @@
+package tracer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Console is a Storer that prints traces in a human-readable form,
+// as an indented tree of spans with their durations, tags, errors and
+// logs.
+// It is meant for local development, where running a server would be
+// inconvenient.
+//
+// Spans are buffered until the root span of their trace finishes.
+// Partial snapshots of spans are ignored.
+// Traces whose root span doesn't finish within a timeout, for example
+// because it runs in a different process, are printed incompletely.
+type Console struct {
+	mu      sync.Mutex
+	w       io.Writer
+	timeout time.Duration
+	traces  map[uint64]*consoleTrace
+	done    chan struct{}
+	once    sync.Once
+}
+
+type consoleTrace struct {
+	spans []RawSpan
+	first time.Time
+}
+
+// ConsoleOptions are options for the Console storer.
+type ConsoleOptions struct {
+	// Where to print traces. Defaults to os.Stderr.
+	Writer io.Writer
+	// How long to wait for the root span of a trace before printing
+	// it anyway. Values less than or equal to zero mean the default
+	// of 10 seconds.
+	Timeout time.Duration
+}
+
+// NewConsole returns a new Console.
+func NewConsole(opts *ConsoleOptions) *Console {
+	if opts == nil {
+		opts = &ConsoleOptions{}
+	}
+	c := &Console{
+		w:       opts.Writer,
+		timeout: opts.Timeout,
+		traces:  map[uint64]*consoleTrace{},
+		done:    make(chan struct{}),
+	}
+	if c.w == nil {
+		c.w = os.Stderr
+	}
+	if c.timeout <= 0 {
+		c.timeout = 10 * time.Second
+	}
+	go c.loop()
+	return c
+}
+
+func (c *Console) loop() {
+	interval := c.timeout / 2
+	if interval == 0 {
+		interval = c.timeout
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.mu.Lock()
+			for id, tr := range c.traces {
+				if time.Since(tr.first) > c.timeout {
+					c.print(id, tr.spans)
+					delete(c.traces, id)
+				}
+			}
+			c.mu.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Store implements the tracer.Storer interface.
+func (c *Console) Store(sp RawSpan) error {
+	if sp.Flags&FlagPartial != 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tr, ok := c.traces[sp.TraceID]
+	if !ok {
+		tr = &consoleTrace{first: time.Now()}
+		c.traces[sp.TraceID] = tr
+	}
+	tr.spans = append(tr.spans, sp)
+	if sp.ParentID == 0 {
+		c.print(sp.TraceID, tr.spans)
+		delete(c.traces, sp.TraceID)
+	}
+	return nil
+}
+
+// Flush implements the tracer.Flusher interface. It prints all
+// buffered traces, even if they are incomplete.
+func (c *Console) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, tr := range c.traces {
+		c.print(id, tr.spans)
+		delete(c.traces, id)
+	}
+	return nil
+}
+
+// Close implements the tracer.Closer interface. It prints all
+// buffered traces and stops the background goroutine.
+func (c *Console) Close(ctx context.Context) error {
+	c.once.Do(func() { close(c.done) })
+	return c.Flush()
+}
+
+func (c *Console) print(traceID uint64, spans []RawSpan) {
+	ids := map[uint64]bool{}
+	for _, sp := range spans {
+		ids[sp.SpanID] = true
+	}
+	children := map[uint64][]RawSpan{}
+	for _, sp := range spans {
+		parent := sp.ParentID
+		if !ids[parent] {
+			// The parent is missing, either because sp is the root
+			// or because the trace is incomplete.
+			parent = 0
+		}
+		children[parent] = append(children[parent], sp)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "trace %016x\n", traceID)
+	var printSubtrace func(parent uint64, level int)
+	printSubtrace = func(parent uint64, level int) {
+		spans := children[parent]
+		sort.Sort(byStartTime(spans))
+		for _, sp := range spans {
+			indent := strings.Repeat("\t", level)
+			fmt.Fprintf(buf, "%s%s:%s (%s)", indent, sp.ServiceName, sp.OperationName, sp.FinishTime.Sub(sp.StartTime))
+			if len(sp.Tags) > 0 {
+				fmt.Fprintf(buf, " [%s]", consoleTags(sp.Tags))
+			}
+			if sp.Status.Code == StatusError {
+				buf.WriteString(" ERROR")
+				if sp.Status.Message != "" {
+					fmt.Fprintf(buf, ": %s", sp.Status.Message)
+				}
+			}
+			buf.WriteString("\n")
+			for _, l := range sp.Logs {
+				fmt.Fprintf(buf, "%s\t+%s %s", indent, l.Timestamp.Sub(sp.StartTime), l.Event)
+				if l.Payload != nil {
+					fmt.Fprintf(buf, ": %v", l.Payload)
+				}
+				buf.WriteString("\n")
+			}
+			if sp.SpanID != parent {
+				printSubtrace(sp.SpanID, level+1)
+			}
+		}
+	}
+	printSubtrace(0, 0)
+	_, _ = c.w.Write(buf.Bytes())
+}
+
+func consoleTags(tags map[string]interface{}) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var out []string
+	for _, k := range keys {
+		if v := tags[k]; v == nil {
+			out = append(out, k)
+		} else {
+			out = append(out, fmt.Sprintf("%s=%#v", k, v))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+type byStartTime []RawSpan
+
+func (s byStartTime) Len() int           { return len(s) }
+func (s byStartTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byStartTime) Less(i, j int) bool { return s[i].StartTime.Before(s[j].StartTime) }
@@ -0,0 +1,62 @@
+package tracer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestConsole(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewConsole(&ConsoleOptions{Writer: buf})
+	defer c.Close(context.Background())
+
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	child := RawSpan{
+		SpanContext:   SpanContext{TraceID: 1, SpanID: 2, ParentID: 1},
+		ServiceName:   "backend",
+		OperationName: "query",
+		StartTime:     start.Add(time.Millisecond),
+		FinishTime:    start.Add(3 * time.Millisecond),
+		Tags:          map[string]interface{}{"error": true},
+	}
+	root := RawSpan{
+		SpanContext:   SpanContext{TraceID: 1, SpanID: 1},
+		ServiceName:   "frontend",
+		OperationName: "request",
+		StartTime:     start,
+		FinishTime:    start.Add(5 * time.Millisecond),
+	}
+	_ = c.Store(child)
+	if buf.Len() != 0 {
+		t.Fatal("printed trace before the root span finished")
+	}
+	_ = c.Store(root)
+
+	want := "trace 0000000000000001\n" +
+		"frontend:request (5ms)\n" +
+		"\tbackend:query (2ms) [error=true]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	_ = c.Store(RawSpan{SpanContext: SpanContext{TraceID: 2, SpanID: 3, ParentID: 4}})
+	_ = c.Flush()
+	if !strings.HasPrefix(buf.String(), "trace 0000000000000002\n") {
+		t.Errorf("incomplete trace wasn't printed on flush, got %q", buf.String())
+	}
+}
+
+func TestConsoleTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{-time.Second, 0, 1} {
+		c := NewConsole(&ConsoleOptions{Writer: &bytes.Buffer{}, Timeout: timeout})
+		if timeout <= 0 && c.timeout != 10*time.Second {
+			t.Errorf("got timeout %s for %s, want the default", c.timeout, timeout)
+		}
+		_ = c.Close(context.Background())
+	}
+}
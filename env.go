@@ -0,0 +1,78 @@
+package tracer
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// The environment variables used by the Environment format.
+const (
+	envTraceParent = "TRACEPARENT"
+	envBaggage     = "BAGGAGE"
+)
+
+// ExtractEnvironment extracts a span context that the parent process
+// injected into the environment of this process, using the
+// Environment format. Programs that are executed by other
+// instrumented programs can call it at startup and start their root
+// span as a child of the returned context.
+func ExtractEnvironment(tr opentracing.Tracer) (opentracing.SpanContext, error) {
+	return tr.Extract(Environment, os.Environ())
+}
+
+func envInjecter(sm SpanContext, carrier interface{}) error {
+	var env *[]string
+	switch c := carrier.(type) {
+	case *exec.Cmd:
+		if c.Env == nil {
+			c.Env = os.Environ()
+		}
+		env = &c.Env
+	case *[]string:
+		env = c
+	default:
+		return opentracing.ErrInvalidCarrier
+	}
+
+	out := (*env)[:0:0]
+	for _, kv := range *env {
+		if strings.HasPrefix(kv, envTraceParent+"=") || strings.HasPrefix(kv, envBaggage+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	out = append(out, envTraceParent+"="+formatTraceParent(sm))
+	if len(sm.Baggage) > 0 {
+		out = append(out, envBaggage+"="+formatBaggage(sm.Baggage))
+	}
+	*env = out
+	return nil
+}
+
+func envExtracter(carrier interface{}) (SpanContext, error) {
+	env, ok := carrier.([]string)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var traceParent, baggage string
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envTraceParent+"=") {
+			traceParent = kv[len(envTraceParent)+1:]
+		} else if strings.HasPrefix(kv, envBaggage+"=") {
+			baggage = kv[len(envBaggage)+1:]
+		}
+	}
+	if traceParent == "" {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	ctx, err := parseTraceParent(traceParent)
+	if err != nil {
+		return SpanContext{}, err
+	}
+	parseBaggage(baggage, ctx.Baggage)
+	return ctx, nil
+}
@@ -0,0 +1,130 @@
+package tracer
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// File is a Storer that appends spans to a file, one JSON-encoded
+// RawSpan per line. It is useful for hosts that can't reach a server;
+// the files can be imported later with "tracer-cli import".
+//
+// When the file grows too large or too old, it is rotated: it is
+// renamed by appending the time of rotation to its name, and a new
+// file is started.
+type File struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	f       *os.File
+	size    int64
+	opened  time.Time
+	closed  bool
+}
+
+// FileOptions are options for the File storer.
+type FileOptions struct {
+	// The size in bytes at which files are rotated. Defaults to 100
+	// MiB.
+	MaxSize int64
+	// The age at which files are rotated. Zero disables rotation by
+	// age.
+	MaxAge time.Duration
+}
+
+// NewFile returns a new File that writes to path, appending to it if
+// it already exists.
+func NewFile(path string, opts *FileOptions) (*File, error) {
+	if opts == nil {
+		opts = &FileOptions{}
+	}
+	f := &File{
+		path:    path,
+		maxSize: opts.MaxSize,
+		maxAge:  opts.MaxAge,
+	}
+	if f.maxSize == 0 {
+		f.maxSize = 100 * 1024 * 1024
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	fd, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return err
+	}
+	f.f = fd
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	f.f = nil
+	name := f.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(f.path, name); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Store implements the tracer.Storer interface.
+func (f *File) Store(sp RawSpan) error {
+	b, err := json.Marshal(sp)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrStorerClosed
+	}
+	if f.f == nil {
+		// A previous rotation failed half-way.
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	tooLarge := f.size > 0 && f.size+int64(len(b)) > f.maxSize
+	tooOld := f.maxAge > 0 && time.Since(f.opened) > f.maxAge
+	if tooLarge || tooOld {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.f.Write(b)
+	f.size += int64(n)
+	return err
+}
+
+// Close implements the tracer.Closer interface.
+func (f *File) Close(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
@@ -0,0 +1,72 @@
+package tracer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracer-file")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spans.jsonl")
+	f, err := NewFile(path, &FileOptions{MaxSize: 300})
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	for i := uint64(1); i <= 10; i++ {
+		sp := RawSpan{
+			SpanContext:   SpanContext{TraceID: 1, SpanID: i},
+			OperationName: "op",
+		}
+		if err := f.Store(sp); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	}
+	if err := f.Close(context.Background()); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if err := f.Store(RawSpan{}); err != ErrStorerClosed {
+		t.Errorf("got %v, want ErrStorerClosed", err)
+	}
+
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("got %d files, expected rotation", len(files))
+	}
+	seen := map[uint64]bool{}
+	for _, name := range files {
+		fd, err := os.Open(name)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		info, _ := fd.Stat()
+		if info.Size() > 300 {
+			t.Errorf("%s has %d bytes, want at most 300", name, info.Size())
+		}
+		sc := bufio.NewScanner(fd)
+		for sc.Scan() {
+			var sp RawSpan
+			if err := json.Unmarshal(sc.Bytes(), &sp); err != nil {
+				t.Fatal("unexpected error: ", err)
+			}
+			seen[sp.SpanID] = true
+		}
+		fd.Close()
+	}
+	if len(seen) != 10 {
+		t.Errorf("got %d spans, want 10", len(seen))
+	}
+}
@@ -2,178 +2,452 @@ package tracer
 
 import (
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/tracer/tracer/pb"
 
-	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/proto"
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
-// GRPC is a gRPC-based transport for sending spans to a server.
+// GRPC is a gRPC-based transport for sending spans to one or more
+// servers.
 type GRPC struct {
-	client        pb.StorerClient
-	queue         []RawSpan
-	ch            chan RawSpan
-	flushCh       chan chan error
-	flushInterval time.Duration
-	logger        Logger
+	b        *batcher
+	backends []*grpcBackend
+	dialOpts []grpc.DialOption
+	next     int
 
-	stored  prometheus.Counter
-	dropped prometheus.Counter
+	// Only used when balancing across multiple servers.
+	addresses       []string
+	byTrace         bool
+	resolveInterval time.Duration
+	resolved        time.Time
 }
 
 // GRPCOptions are options for the GRPC storer.
 type GRPCOptions struct {
 	// How many spans to queue before sending them to the server.
 	// Additionally, a buffer the size of 2*QueueSize will be used to
-	// process new spans. If this buffer runs full, new spans will be
-	// dropped.
+	// process new spans. If this buffer runs full, QueuePolicy
+	// determines which spans will be dropped. Defaults to 1024.
 	QueueSize int
+	// The maximum size of a batch of spans, in bytes. Batches are sent
+	// early to stay below the limit, and spans that exceed it on their
+	// own are dropped. Defaults to 1 MiB, which is well below the
+	// default message size limit of gRPC servers.
+	MaxBatchBytes int
+	// What to do with new spans when the buffer is full. The default
+	// is DropNewest.
+	QueuePolicy QueuePolicy
+	// How long Store blocks under the Block policy. Defaults to 100ms.
+	BlockTimeout time.Duration
 	// How often to flush spans, even if the queue isn't full yet.
+	// Defaults to one second.
 	FlushInterval time.Duration
 	// Where to log errors. If nil, the default logger will be used.
 	Logger Logger
+
+	// Where to register metrics. If nil, the default Prometheus
+	// registerer will be used.
+	Registerer prometheus.Registerer
+	// Labels to add to all metrics. Processes that use multiple
+	// storers with the same registerer must use them to tell the
+	// storers apart. Otherwise, creating the storers fails if
+	// Registerer is set, and only the first storer's metrics are
+	// registered if it isn't. Closing a storer unregisters its
+	// metrics.
+	ConstLabels prometheus.Labels
+
+	// How often to retry sending a batch of spans. Zero disables
+	// retries.
+	MaxRetries int
+	// How long to wait before the first retry. The wait doubles with
+	// each retry, up to MaxBackoff, and is randomized to avoid many
+	// clients retrying in lockstep. They default to 100ms and 5s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// If not empty, batches that couldn't be sent even after retrying
+	// are written to this directory and sent once the server is
+	// reachable again. Spooled batches survive restarts of the
+	// process. The directory must not be shared by storers that run
+	// at the same time, in the same or in different processes: they
+	// would take sequence numbers from the same directory and replay
+	// each other's batches.
+	SpoolDir string
+	// The maximum size of the spool, in bytes. When it is exceeded,
+	// the oldest batches are dropped. Defaults to 64 MiB.
+	SpoolSize int64
 }
 
 // NewGRPC returns a new Storer that sends spans via gRPC to a server.
 func NewGRPC(address string, grpcOpts *GRPCOptions, opts ...grpc.DialOption) (Storer, error) {
-	if grpcOpts == nil {
-		grpcOpts = &GRPCOptions{
-			QueueSize:     1024,
-			FlushInterval: 1 * time.Second,
-		}
-	}
-	if grpcOpts.Logger == nil {
-		grpcOpts.Logger = defaultLogger{}
-	}
-	conn, err := grpc.Dial(address, opts...)
+	be, err := dialBackend(address, opts)
 	if err != nil {
 		return nil, err
 	}
-	client := pb.NewStorerClient(conn)
 	g := &GRPC{
-		client:        client,
-		queue:         make([]RawSpan, 0, grpcOpts.QueueSize),
-		ch:            make(chan RawSpan, grpcOpts.QueueSize*2),
-		flushCh:       make(chan chan error),
-		flushInterval: grpcOpts.FlushInterval,
-		logger:        grpcOpts.Logger,
-
-		stored: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "tracer_stored_spans_total",
-			Help: "Number of stored spans",
-		}),
-		dropped: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "tracer_dropped_spans_total",
-			Help: "Number of dropped spans",
-		}),
-	}
-	err = prometheus.Register(g.dropped)
-	if err != nil {
-		g.logger.Printf("couldn't register prometheus counter: %s", err)
+		backends: []*grpcBackend{be},
+		dialOpts: opts,
 	}
-	err = prometheus.Register(g.stored)
+	g.b, err = newBatcher(g, grpcOpts)
 	if err != nil {
-		g.logger.Printf("couldn't register prometheus counter: %s", err)
+		_ = be.close()
+		return nil, err
 	}
-	go g.loop()
+	go g.b.loop()
 	return g, nil
 }
 
-func (g *GRPC) loop() {
-	t := time.NewTicker(g.flushInterval)
-	for {
-		select {
-		case sp := <-g.ch:
-			g.queue = append(g.queue, sp)
-			if len(g.queue) == cap(g.queue) {
-				if err := g.flush(); err != nil {
-					g.logger.Printf("couldn't flush spans: %s", err)
-				}
-			}
-		case <-t.C:
-			if err := g.flush(); err != nil {
-				g.logger.Printf("couldn't flush spans: %s", err)
-			}
-		case ch := <-g.flushCh:
-			ch <- g.flush()
-		}
+func (g *GRPC) encode(sp RawSpan) (interface{}, int, error) {
+	return encodeProto(sp)
+}
+
+func (g *GRPC) send(ctx context.Context, batch []interface{}) error {
+	return g.store(ctx, protoBatch(batch))
+}
+
+func (g *GRPC) marshal(batch []interface{}) ([]byte, error) {
+	return proto.Marshal(protoBatch(batch))
+}
+
+func (g *GRPC) sendMarshaled(ctx context.Context, b []byte) error {
+	req := &pb.StoreRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		return permanentError{err}
 	}
+	return g.store(ctx, req)
 }
 
-func (g *GRPC) flush() error {
-	if len(g.queue) == 0 {
-		return nil
+// retryable reports whether sending a request may succeed if tried
+// again. Requests that the server rejected as invalid will not.
+func (g *GRPC) retryable(err error) bool {
+	switch grpc.Code(err) {
+	case codes.InvalidArgument, codes.Unimplemented, codes.Unauthenticated, codes.PermissionDenied:
+		return false
+	default:
+		return true
 	}
-	var pbs []*pb.Span
-	for _, sp := range g.queue {
-		pst, err := ptypes.TimestampProto(sp.StartTime)
-		if err != nil {
-			g.logger.Printf("dropping span because of error: %s", err)
-			continue
+}
+
+func (g *GRPC) close() error {
+	var errs multiError
+	for _, be := range g.backends {
+		if err := be.close(); err != nil {
+			errs = append(errs, err)
 		}
-		pft, err := ptypes.TimestampProto(sp.FinishTime)
-		if err != nil {
-			g.logger.Printf("dropping span because of error: %s", err)
+	}
+	return errs.err()
+}
+
+// protoSpan is a span in its protobuf representation, along with its
+// process, which is only converted once per batch.
+type protoSpan struct {
+	span    *pb.Span
+	process *Process
+}
+
+// encodeProto encodes a span as a protoSpan. The returned size is the
+// size of the span as an element of StoreRequest.Spans. It doesn't
+// include the span's process, which is small and shared by many
+// spans.
+func encodeProto(sp RawSpan) (interface{}, int, error) {
+	psp := spanToProto(sp)
+	// Account for the process index.
+	n := proto.Size(psp) + 1 + proto.SizeVarint(math.MaxUint32)
+	return protoSpan{psp, sp.Process}, 1 + proto.SizeVarint(uint64(n)) + n, nil
+}
+
+// protoBatch returns a request with the spans of a batch of
+// protoSpans and each of their distinct processes.
+func protoBatch(batch []interface{}) *pb.StoreRequest {
+	req := &pb.StoreRequest{Spans: make([]*pb.Span, len(batch))}
+	indices := map[*Process]uint32{}
+	for i, item := range batch {
+		psp := item.(protoSpan)
+		req.Spans[i] = psp.span
+		if psp.process == nil {
 			continue
 		}
-		var tags []*pb.Tag
-		for k, v := range sp.Tags {
-			vs := fmt.Sprintf("%v", v) // XXX
-			tags = append(tags, &pb.Tag{
-				Key:   k,
-				Value: vs,
-			})
+		idx, ok := indices[psp.process]
+		if !ok {
+			req.Processes = append(req.Processes, processToProto(psp.process))
+			idx = uint32(len(req.Processes))
+			indices[psp.process] = idx
+		}
+		psp.span.ProcessIndex = idx
+	}
+	return req
+}
+
+// processToProto converts a process to its protobuf representation.
+func processToProto(p *Process) *pb.Process {
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pp := &pb.Process{Tags: make([]*pb.Tag, len(keys))}
+	for i, k := range keys {
+		pp.Tags[i] = &pb.Tag{Key: k, Value: p.Tags[k]}
+	}
+	return pp
+}
+
+// spanToProto converts a span to its protobuf representation. All
+// tags and log entries of the span share a single allocation.
+func spanToProto(sp RawSpan) *pb.Span {
+	n := len(sp.Tags) + len(sp.Logs)
+	tagValues := make([]pb.Tag, n)
+	tags := make([]*pb.Tag, n)
+	i := 0
+	for k, v := range sp.Tags {
+		tagValues[i] = pb.Tag{
+			Key:   k,
+			Value: formatValue(v),
+		}
+		tags[i] = &tagValues[i]
+		i++
+	}
+	for _, l := range sp.Logs {
+		tagValues[i] = pb.Tag{
+			Key:          l.Event,
+			Value:        formatValue(l.Payload),
+			TimeUnixNano: unixNano(l.Timestamp),
 		}
-		for _, l := range sp.Logs {
-			t, err := ptypes.TimestampProto(l.Timestamp)
-			if err != nil {
-				g.logger.Printf("dropping log entry because of error: %s", err)
-				continue
+		tags[i] = &tagValues[i]
+		i++
+	}
+	return &pb.Span{
+		SpanId:             sp.SpanID,
+		ParentId:           sp.ParentID,
+		TraceId:            sp.TraceID,
+		ServiceName:        sp.ServiceName,
+		OperationName:      sp.OperationName,
+		StartTimeUnixNano:  unixNano(sp.StartTime),
+		FinishTimeUnixNano: unixNano(sp.FinishTime),
+		Flags:              sp.Flags,
+		Tags:               tags,
+		Kind:               pb.SpanKind(sp.Kind),
+		StatusCode:         pb.StatusCode(sp.Status.Code),
+		StatusMessage:      sp.Status.Message,
+	}
+}
+
+// formatValue formats a tag value or log payload like fmt's %v verb,
+// but avoids fmt for common types.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// unixNano returns t in nanoseconds since the Unix epoch, or 0 for the
+// zero time.
+// addLegacyFields fills in the deprecated fields of the spans in req,
+// which servers that don't support streaming rely on instead of the
+// newer ones. It also adds the span.kind and error tags that the
+// spans' kinds and statuses were set from, which such servers don't
+// know about. It can be called repeatedly on the same request.
+func addLegacyFields(req *pb.StoreRequest) {
+	for _, sp := range req.Spans {
+		if sp.StartTime == nil {
+			sp.StartTime = timestampProto(sp.StartTimeUnixNano)
+		}
+		if sp.FinishTime == nil {
+			sp.FinishTime = timestampProto(sp.FinishTimeUnixNano)
+		}
+		hasKind, hasError := false, false
+		for _, tag := range sp.Tags {
+			if tag.Time == nil {
+				tag.Time = timestampProto(tag.TimeUnixNano)
+			}
+			if tag.TimeUnixNano == 0 {
+				hasKind = hasKind || tag.Key == string(ext.SpanKind)
+				hasError = hasError || tag.Key == string(ext.Error)
 			}
-			ps := fmt.Sprintf("%v", l.Payload) // XXX
-			tags = append(tags, &pb.Tag{
-				Key:   l.Event,
-				Value: ps,
-				Time:  t,
+		}
+		if sp.Kind != pb.SpanKind_KIND_UNSPECIFIED && !hasKind {
+			sp.Tags = append(sp.Tags, &pb.Tag{
+				Key:   string(ext.SpanKind),
+				Value: SpanKind(sp.Kind).String(),
 			})
 		}
-		psp := &pb.Span{
-			SpanId:        sp.SpanID,
-			ParentId:      sp.ParentID,
-			TraceId:       sp.TraceID,
-			ServiceName:   sp.ServiceName,
-			OperationName: sp.OperationName,
-			StartTime:     pst,
-			FinishTime:    pft,
-			Flags:         sp.Flags,
-			Tags:          tags,
+		if sp.StatusCode != pb.StatusCode_STATUS_UNSET && !hasError {
+			sp.Tags = append(sp.Tags, &pb.Tag{
+				Key:   string(ext.Error),
+				Value: strconv.FormatBool(sp.StatusCode == pb.StatusCode_STATUS_ERROR),
+			})
 		}
-		pbs = append(pbs, psp)
 	}
-	g.queue = g.queue[0:0]
-	if _, err := g.client.Store(context.Background(), &pb.StoreRequest{Spans: pbs}); err != nil {
-		return err
+}
+
+// timestampProto converts a time in nanoseconds since the Unix epoch
+// to a protobuf timestamp. It returns nil when nanos is 0.
+func timestampProto(nanos uint64) *tspb.Timestamp {
+	if nanos == 0 {
+		return nil
+	}
+	return &tspb.Timestamp{
+		Seconds: int64(nanos / uint64(time.Second)),
+		Nanos:   int32(nanos % uint64(time.Second)),
+	}
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// grpcBackend is the connection to a single server.
+type grpcBackend struct {
+	address      string
+	hash         uint64
+	conn         *grpc.ClientConn
+	client       pb.StorerClient
+	stream       pb.Storer_StoreStreamClient
+	cancelStream context.CancelFunc
+	unary        bool
+
+	// The number of consecutive failures, and until when the server
+	// is considered to be down because of them.
+	failures  int
+	downUntil time.Time
+}
+
+func dialBackend(address string, opts []grpc.DialOption) (*grpcBackend, error) {
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	h := fnv.New64a()
+	_, _ = io.WriteString(h, address)
+	return &grpcBackend{
+		address: address,
+		hash:    h.Sum64(),
+		conn:    conn,
+		client:  pb.NewStorerClient(conn),
+	}, nil
+}
+
+// store sends a single request to the server. It uses a long-lived
+// stream, unless the server is too old to support it.
+func (be *grpcBackend) store(ctx context.Context, req *pb.StoreRequest, logger Logger) error {
+	if !be.unary {
+		err := be.storeStream(ctx, req)
+		if grpc.Code(err) != codes.Unimplemented {
+			return err
+		}
+		logger.Printf("server %s doesn't support streaming, falling back to unary RPCs", be.address)
+		be.unary = true
+	}
+	addLegacyFields(req)
+	_, err := be.client.Store(ctx, req)
+	return err
+}
+
+func (be *grpcBackend) storeStream(ctx context.Context, req *pb.StoreRequest) error {
+	if be.stream == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := be.client.StoreStream(ctx)
+		if err != nil {
+			cancel()
+			return err
+		}
+		be.stream = stream
+		be.cancelStream = cancel
+	}
+	if ctx.Done() != nil {
+		// The stream outlives ctx, so abort it explicitly if ctx
+		// expires while we wait for the server.
+		cancel := be.cancelStream
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancel()
+			case <-done:
+			}
+		}()
+	}
+	err := be.stream.Send(req)
+	if err == io.EOF {
+		// The stream was aborted; the actual error is returned by
+		// Recv.
+		_, err = be.stream.Recv()
+	} else if err == nil {
+		_, err = be.stream.Recv()
+	}
+	if err != nil {
+		be.closeStream()
+	}
+	return err
+}
+
+func (be *grpcBackend) closeStream() {
+	if be.stream == nil {
+		return
+	}
+	be.cancelStream()
+	be.stream = nil
+	be.cancelStream = nil
+}
+
+func (be *grpcBackend) close() error {
+	if be.stream != nil {
+		_ = be.stream.CloseSend()
+		be.closeStream()
+	}
+	return be.conn.Close()
 }
 
 // Store implements the tracer.Storer interface.
 func (g *GRPC) Store(sp RawSpan) error {
-	select {
-	case g.ch <- sp:
-		g.stored.Inc()
-	default:
-		g.dropped.Inc()
-	}
-	return nil
+	return g.b.Store(sp)
 }
 
+// Flush implements the tracer.Flusher interface.
 func (g *GRPC) Flush() error {
-	ch := make(chan error)
-	g.flushCh <- ch
-	return <-ch
+	return g.b.Flush()
+}
+
+// Close implements the tracer.Closer interface. It sends all buffered
+// spans, stops the background goroutine and closes the connection to
+// the server. Closing an already closed storer does nothing.
+func (g *GRPC) Close(ctx context.Context) error {
+	return g.b.Close(ctx)
 }
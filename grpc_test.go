@@ -0,0 +1,76 @@
+package tracer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tracer/tracer/pb"
+
+	"github.com/golang/protobuf/ptypes"
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/opentracing/opentracing-go"
+)
+
+func TestFormatValue(t *testing.T) {
+	values := []interface{}{"s", true, -1, int32(2), int64(3), uint(4), uint16(5), uint32(6), uint64(7), 0.1, 1e21, float32(0.5), nil}
+	for _, v := range values {
+		if got, want := formatValue(v), fmt.Sprintf("%v", v); got != want {
+			t.Errorf("got %q for %#v, want %q", got, v, want)
+		}
+	}
+}
+
+func BenchmarkSpanToProto(b *testing.B) {
+	now := time.Now()
+	sp := RawSpan{
+		SpanContext:   SpanContext{TraceID: 1, SpanID: 2, ParentID: 3},
+		ServiceName:   "svc",
+		OperationName: "op",
+		StartTime:     now,
+		FinishTime:    now,
+		Tags:          map[string]interface{}{"component": "grpc", "peer.port": 1234, "error": false},
+		Logs:          []opentracing.LogData{{Timestamp: now, Event: "event", Payload: "payload"}},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		spanToProto(sp)
+	}
+}
+
+func TestAddLegacyFields(t *testing.T) {
+	start := time.Unix(1500000000, 123456789)
+	sp := RawSpan{
+		StartTime:  start,
+		FinishTime: start.Add(time.Second),
+		Logs:       []opentracing.LogData{{Timestamp: start.Add(time.Millisecond), Event: "e"}},
+		Kind:       KindClient,
+		Status:     Status{Code: StatusError},
+	}
+	req := &pb.StoreRequest{Spans: []*pb.Span{spanToProto(sp)}}
+	addLegacyFields(req)
+	// Retries send the same request again.
+	addLegacyFields(req)
+	psp := req.Spans[0]
+	tags := map[string]string{}
+	for _, tag := range psp.Tags[1:] {
+		tags[tag.Key] = tag.Value
+	}
+	if len(psp.Tags) != 3 || tags["span.kind"] != "client" || tags["error"] != "true" {
+		t.Errorf("got tags %v, want a log entry and span.kind and error tags", psp.Tags)
+	}
+	times := []struct {
+		ts   *tspb.Timestamp
+		want time.Time
+	}{
+		{psp.StartTime, sp.StartTime},
+		{psp.FinishTime, sp.FinishTime},
+		{psp.Tags[0].Time, sp.Logs[0].Timestamp},
+	}
+	for _, tt := range times {
+		got, err := ptypes.Timestamp(tt.ts)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("got legacy timestamp %v (%v), want %v", got, err, tt.want)
+		}
+	}
+}
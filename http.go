@@ -0,0 +1,190 @@
+package tracer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// HTTPEncoding is the encoding of batches sent by the HTTP storer.
+type HTTPEncoding int
+
+const (
+	// HTTPJSON encodes batches as a JSON array of RawSpans.
+	HTTPJSON HTTPEncoding = iota
+	// HTTPProtobuf encodes batches as a protobuf StoreRequest.
+	HTTPProtobuf
+)
+
+// HTTP is an HTTP-based transport for sending spans to a server. It
+// is useful in environments that don't allow gRPC traffic, for
+// example because of proxies. Batches are POSTed gzip-compressed.
+type HTTP struct {
+	b        *batcher
+	url      string
+	encoding HTTPEncoding
+	client   *http.Client
+}
+
+// HTTPOptions are options for the HTTP storer.
+type HTTPOptions struct {
+	// Options for queueing, batching, retrying and spooling. They
+	// work the same as for the GRPC storer. If nil, the defaults of
+	// the GRPC storer will be used.
+	Queue *GRPCOptions
+	// How to encode batches.
+	Encoding HTTPEncoding
+	// The client to send requests with. If nil, http.DefaultClient
+	// will be used.
+	Client *http.Client
+}
+
+// NewHTTP returns a new Storer that sends spans via HTTP to a server.
+// url is the URL of the server's storage endpoint, for example
+// http://localhost:9997/spans.
+func NewHTTP(url string, opts *HTTPOptions) (Storer, error) {
+	if opts == nil {
+		opts = &HTTPOptions{}
+	}
+	h := &HTTP{
+		url:      url,
+		encoding: opts.Encoding,
+		client:   opts.Client,
+	}
+	if h.client == nil {
+		h.client = http.DefaultClient
+	}
+	var err error
+	h.b, err = newBatcher(h, opts.Queue)
+	if err != nil {
+		return nil, err
+	}
+	go h.b.loop()
+	return h, nil
+}
+
+func (h *HTTP) encode(sp RawSpan) (interface{}, int, error) {
+	if h.encoding == HTTPProtobuf {
+		return encodeProto(sp)
+	}
+	b, err := json.Marshal(sp)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Account for the separating comma.
+	return json.RawMessage(b), len(b) + 1, nil
+}
+
+func (h *HTTP) marshal(batch []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if h.encoding == HTTPProtobuf {
+		b, err := proto.Marshal(protoBatch(batch))
+		if err != nil {
+			return nil, err
+		}
+		_, _ = w.Write(b)
+	} else {
+		_, _ = io.WriteString(w, "[")
+		for i, item := range batch {
+			if i > 0 {
+				_, _ = io.WriteString(w, ",")
+			}
+			_, _ = w.Write(item.(json.RawMessage))
+		}
+		_, _ = io.WriteString(w, "]")
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *HTTP) send(ctx context.Context, batch []interface{}) error {
+	b, err := h.marshal(batch)
+	if err != nil {
+		return permanentError{err}
+	}
+	return h.sendMarshaled(ctx, b)
+}
+
+// httpError is the error returned for unsuccessful HTTP responses.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (err httpError) Error() string {
+	return fmt.Sprintf("server returned status %d: %s", err.status, err.msg)
+}
+
+func (h *HTTP) sendMarshaled(ctx context.Context, b []byte) error {
+	req, err := http.NewRequest("POST", h.url, bytes.NewReader(b))
+	if err != nil {
+		return permanentError{err}
+	}
+	if h.encoding == HTTPProtobuf {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := ctxhttp.Do(ctx, h.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return httpError{resp.StatusCode, string(bytes.TrimSpace(msg))}
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// retryable reports whether sending a request may succeed if tried
+// again. Network errors and server errors are considered transient,
+// other client errors are not.
+func (h *HTTP) retryable(err error) bool {
+	herr, ok := err.(httpError)
+	if !ok {
+		return true
+	}
+	switch {
+	case herr.status >= 500:
+		return true
+	case herr.status == http.StatusRequestTimeout, herr.status == 429:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *HTTP) close() error {
+	return nil
+}
+
+// Store implements the tracer.Storer interface.
+func (h *HTTP) Store(sp RawSpan) error {
+	return h.b.Store(sp)
+}
+
+// Flush implements the tracer.Flusher interface.
+func (h *HTTP) Flush() error {
+	return h.b.Flush()
+}
+
+// Close implements the tracer.Closer interface. It sends all buffered
+// spans and stops the background goroutine. Closing an already closed
+// storer does nothing.
+func (h *HTTP) Close(ctx context.Context) error {
+	return h.b.Close(ctx)
+}
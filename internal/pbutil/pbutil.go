@@ -1,10 +1,16 @@
 package pbutil
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/tracer/tracer"
+	"github.com/tracer/tracer/pb"
+
 	"github.com/golang/protobuf/ptypes"
 	tspb "github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
 // Timestamp converts a protobuf timestamp to a Go time.Time. It
@@ -15,3 +21,130 @@ func Timestamp(ts *tspb.Timestamp) (time.Time, error) {
 	}
 	return ptypes.Timestamp(ts)
 }
+
+// Time converts a time in nanoseconds since the Unix epoch to a Go
+// time.Time. If nanos is 0, it converts the deprecated protobuf
+// timestamp ts instead, which older clients send.
+func Time(nanos uint64, ts *tspb.Timestamp) (time.Time, error) {
+	if nanos != 0 {
+		return time.Unix(0, int64(nanos)).UTC(), nil
+	}
+	return Timestamp(ts)
+}
+
+// RawSpan converts a protobuf span to a tracer.RawSpan. Tags with a
+// time are converted to log entries. The span.kind and error tags of
+// older clients are converted to the span's kind and status.
+func RawSpan(span *pb.Span) (tracer.RawSpan, error) {
+	st, err := Time(span.StartTimeUnixNano, span.StartTime)
+	if err != nil {
+		return tracer.RawSpan{}, err
+	}
+	ft, err := Time(span.FinishTimeUnixNano, span.FinishTime)
+	if err != nil {
+		return tracer.RawSpan{}, err
+	}
+	sp := tracer.RawSpan{
+		SpanContext: tracer.SpanContext{
+			TraceID:  span.TraceId,
+			ParentID: span.ParentId,
+			SpanID:   span.SpanId,
+			Flags:    span.Flags,
+		},
+		ServiceName:   span.ServiceName,
+		OperationName: span.OperationName,
+		StartTime:     st,
+		FinishTime:    ft,
+		Status: tracer.Status{
+			Code:    tracer.StatusCode(span.StatusCode),
+			Message: span.StatusMessage,
+		},
+		Tags: map[string]interface{}{},
+	}
+	// Unknown values, from newer clients, are treated as unset.
+	if _, ok := pb.SpanKind_name[int32(span.Kind)]; ok {
+		sp.Kind = tracer.SpanKind(span.Kind)
+	}
+	if _, ok := pb.StatusCode_name[int32(span.StatusCode)]; !ok {
+		sp.Status.Code = tracer.StatusUnset
+	}
+	for _, tag := range span.Tags {
+		if tag.TimeUnixNano != 0 || tag.Time != nil {
+			t, err := Time(tag.TimeUnixNano, tag.Time)
+			if err != nil {
+				return tracer.RawSpan{}, err
+			}
+			sp.Logs = append(sp.Logs, opentracing.LogData{
+				Event:     tag.Key,
+				Payload:   tag.Value,
+				Timestamp: t,
+			})
+		} else {
+			sp.Tags[tag.Key] = tag.Value
+		}
+	}
+	promoteLegacyTags(&sp)
+	return sp, nil
+}
+
+// promoteLegacyTags moves the span.kind and error tags, which older
+// clients send instead of the span's kind and status, to the span's
+// fields. Newer clients send both when talking to servers without
+// streaming support; the tags are dropped if they agree with the
+// fields.
+func promoteLegacyTags(sp *tracer.RawSpan) {
+	if v, ok := sp.Tags[string(ext.SpanKind)].(string); ok {
+		if kind, err := tracer.ParseSpanKind(v); err == nil && kind != tracer.KindUnspecified {
+			if sp.Kind == tracer.KindUnspecified {
+				sp.Kind = kind
+			}
+			if sp.Kind == kind {
+				delete(sp.Tags, string(ext.SpanKind))
+			}
+		}
+	}
+	if v, ok := sp.Tags[string(ext.Error)].(string); ok {
+		var code tracer.StatusCode
+		switch v {
+		case "true":
+			code = tracer.StatusError
+		case "false":
+			code = tracer.StatusOK
+		default:
+			return
+		}
+		if sp.Status.Code == tracer.StatusUnset {
+			sp.Status.Code = code
+		}
+		if sp.Status.Code == code {
+			delete(sp.Tags, string(ext.Error))
+		}
+	}
+}
+
+// RawSpans converts the spans of a request to tracer.RawSpans. Spans
+// of the same process share a single tracer.Process.
+func RawSpans(req *pb.StoreRequest) ([]tracer.RawSpan, error) {
+	procs := make([]*tracer.Process, len(req.Processes))
+	for i, p := range req.Processes {
+		procs[i] = &tracer.Process{Tags: map[string]string{}}
+		for _, tag := range p.Tags {
+			procs[i].Tags[tag.Key] = tag.Value
+		}
+	}
+	spans := make([]tracer.RawSpan, 0, len(req.Spans))
+	for _, span := range req.Spans {
+		sp, err := RawSpan(span)
+		if err != nil {
+			return nil, err
+		}
+		if idx := span.ProcessIndex; idx > 0 {
+			if int(idx) > len(procs) {
+				return nil, fmt.Errorf("span %016x has invalid process index %d", span.SpanId, idx)
+			}
+			sp.Process = procs[idx-1]
+		}
+		spans = append(spans, sp)
+	}
+	return spans, nil
+}
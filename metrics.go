@@ -0,0 +1,183 @@
+package tracer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// batcherMetrics are the metrics of a storer that sends spans to a
+// server.
+type batcherMetrics struct {
+	stored        prometheus.Counter
+	dropped       prometheus.Counter
+	queueLength   prometheus.Gauge
+	flushDuration prometheus.Histogram
+	batchSpans    prometheus.Histogram
+	batchBytes    prometheus.Histogram
+	sendErrors    prometheus.Counter
+	retries       prometheus.Counter
+
+	// Where the metrics are registered, or nil if they aren't.
+	reg prometheus.Registerer
+}
+
+// newBatcherMetrics returns metrics that are registered with reg, or
+// with the default registerer if reg is nil. If the metrics of another
+// storer with the same labels are registered, the queue lengths of the
+// storers would overwrite each other. For an explicit reg, this is an
+// error; with the default registerer, which programs that predate
+// storer metrics use unknowingly, the metrics are only logged about
+// and not registered.
+func newBatcherMetrics(reg prometheus.Registerer, labels prometheus.Labels, logger Logger) (*batcherMetrics, error) {
+	m := &batcherMetrics{
+		stored: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "tracer_stored_spans_total",
+			Help:        "Number of stored spans",
+			ConstLabels: labels,
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "tracer_dropped_spans_total",
+			Help:        "Number of dropped spans",
+			ConstLabels: labels,
+		}),
+		queueLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "tracer_queued_spans",
+			Help:        "Number of spans waiting to be sent",
+			ConstLabels: labels,
+		}),
+		flushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "tracer_flush_duration_seconds",
+			Help:        "Time taken to send a batch of spans, including retries",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		batchSpans: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "tracer_batch_spans",
+			Help:        "Number of spans per batch",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+		batchBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "tracer_batch_bytes",
+			Help:        "Size of batches in bytes",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(256, 4, 8),
+		}),
+		sendErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "tracer_send_errors_total",
+			Help:        "Number of failed attempts to send a batch",
+			ConstLabels: labels,
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "tracer_send_retries_total",
+			Help:        "Number of retried attempts to send a batch",
+			ConstLabels: labels,
+		}),
+	}
+	explicit := reg != nil
+	if !explicit {
+		reg = prometheus.DefaultRegisterer
+	}
+	collectors := m.collectors()
+	for i, c := range collectors {
+		err := reg.Register(c)
+		if err == nil {
+			continue
+		}
+		// Only unregister our own collectors; the ones that collided
+		// belong to another storer.
+		for _, c := range collectors[:i] {
+			reg.Unregister(c)
+		}
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			return nil, err
+		}
+		if explicit {
+			return nil, fmt.Errorf("metrics of another storer with the same labels are already registered, use distinct ConstLabels: %s", err)
+		}
+		logger.Printf("not registering storer metrics, because another storer's metrics with the same labels are registered; use distinct ConstLabels")
+		return m, nil
+	}
+	m.reg = reg
+	return m, nil
+}
+
+func (m *batcherMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.stored, m.dropped, m.queueLength, m.flushDuration,
+		m.batchSpans, m.batchBytes, m.sendErrors, m.retries,
+	}
+}
+
+// unregister unregisters the metrics, so that a storer that replaces
+// this one may register them again.
+func (m *batcherMetrics) unregister() {
+	if m.reg == nil {
+		return
+	}
+	for _, c := range m.collectors() {
+		m.reg.Unregister(c)
+	}
+}
+
+// REDMetrics records the rate, errors and duration of operations, per
+// service and operation name. Spans with an error status count as
+// errors. Durations of sampled spans carry their trace ID as
+// an exemplar, which allows dashboards to link to example traces.
+//
+// Because operation names are used as labels, they should have a low
+// cardinality.
+type REDMetrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewREDMetrics returns REDMetrics that are registered with reg. If
+// reg is nil, the default Prometheus registerer will be used.
+func NewREDMetrics(reg prometheus.Registerer) (*REDMetrics, error) {
+	labels := []string{"service", "operation"}
+	m := &REDMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tracer_operations_total",
+			Help: "Number of finished operations",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tracer_operation_errors_total",
+			Help: "Number of failed operations",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tracer_operation_duration_seconds",
+			Help:    "Duration of operations",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+	}
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.errors, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *REDMetrics) observe(sp RawSpan, finish time.Time) {
+	values := []string{sp.ServiceName, sp.OperationName}
+	m.requests.WithLabelValues(values...).Inc()
+	if sp.Status.Code == StatusError {
+		m.errors.WithLabelValues(values...).Inc()
+	}
+	d := finish.Sub(sp.StartTime).Seconds()
+	obs := m.duration.WithLabelValues(values...)
+	if sp.Flags&FlagSampled > 0 {
+		if eo, ok := obs.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(d, prometheus.Labels{"trace_id": idToHex(sp.TraceID)})
+			return
+		}
+	}
+	obs.Observe(d)
+}
@@ -0,0 +1,143 @@
+package tracer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestMetricsPerInstance(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	var storers []Storer
+	for _, name := range []string{"a", "b"} {
+		s, err := NewGRPC("127.0.0.1:1", &GRPCOptions{
+			QueueSize:     16,
+			FlushInterval: time.Hour,
+			Registerer:    reg,
+			ConstLabels:   prometheus.Labels{"storer": name},
+		}, grpc.WithInsecure())
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		storers = append(storers, s)
+	}
+	_ = storers[0].Store(RawSpan{})
+	_ = storers[1].Store(RawSpan{})
+	_ = storers[1].Store(RawSpan{})
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	stored := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "tracer_stored_spans_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			stored[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+		}
+	}
+	if stored["a"] != 1 || stored["b"] != 2 {
+		t.Errorf("got stored spans %v, want a=1 b=2", stored)
+	}
+
+	opts := &GRPCOptions{
+		QueueSize:     16,
+		FlushInterval: time.Hour,
+		Registerer:    reg,
+		ConstLabels:   prometheus.Labels{"storer": "a"},
+	}
+	if _, err := NewGRPC("127.0.0.1:1", opts, grpc.WithInsecure()); err == nil {
+		t.Error("got no error for storers with the same labels")
+	}
+
+	for _, s := range storers {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_ = s.(Closer).Close(ctx)
+		cancel()
+	}
+	s, err := NewGRPC("127.0.0.1:1", opts, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal("unexpected error after closing the other storer: ", err)
+	}
+	_ = s.(Closer).Close(context.Background())
+
+	// Programs that predate storer metrics don't set a registerer,
+	// and mustn't break if they use multiple storers.
+	for i := 0; i < 2; i++ {
+		s, err := NewGRPC("127.0.0.1:1", &GRPCOptions{
+			QueueSize:     16,
+			FlushInterval: time.Hour,
+		}, grpc.WithInsecure())
+		if err != nil {
+			t.Fatal("unexpected error with the default registerer: ", err)
+		}
+		defer s.(Closer).Close(context.Background())
+	}
+}
+
+func TestREDMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewREDMetrics(reg)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	storer := &memStorer{}
+	tr := NewTracer("svc", storer, RandomID{})
+	tr.Metrics = m
+
+	tr.Sampler = NewConstSampler(false)
+	sp := tr.StartSpan("op")
+	ext.Error.Set(sp, true)
+	sp.Finish()
+	tr.Sampler = NewConstSampler(true)
+	sp = tr.StartSpan("op")
+	sp.Finish()
+	if len(storer.spans) != 1 {
+		t.Fatalf("got %d stored spans, want 1", len(storer.spans))
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	values := map[string]float64{}
+	exemplars := 0
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch {
+			case m.Counter != nil:
+				values[mf.GetName()] = m.GetCounter().GetValue()
+			case m.Histogram != nil:
+				values[mf.GetName()] = float64(m.GetHistogram().GetSampleCount())
+				for _, b := range m.GetHistogram().GetBucket() {
+					if b.Exemplar == nil {
+						continue
+					}
+					exemplars++
+					if l := b.Exemplar.GetLabel()[0]; l.GetName() != "trace_id" || l.GetValue() != idToHex(storer.spans[0].TraceID) {
+						t.Errorf("got exemplar %v, want trace ID of sampled span", l)
+					}
+				}
+			}
+		}
+	}
+	want := map[string]float64{
+		"tracer_operations_total":           2,
+		"tracer_operation_errors_total":     1,
+		"tracer_operation_duration_seconds": 2,
+	}
+	for k, v := range want {
+		if values[k] != v {
+			t.Errorf("got %s = %v, want %v", k, values[k], v)
+		}
+	}
+	if exemplars != 1 {
+		t.Errorf("got %d exemplars, want 1", exemplars)
+	}
+}
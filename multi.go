@@ -0,0 +1,126 @@
+package tracer
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// A Route forwards matching spans to a Storer.
+type Route struct {
+	// The Storer that receives the spans.
+	Storer Storer
+	// Which spans to forward. If nil, all spans are forwarded.
+	Match func(sp RawSpan) bool
+}
+
+// MatchTag returns a function for Route.Match that matches spans
+// that have the tag key with the value value. For example,
+// MatchTag("component", "grpc") matches gRPC calls. The span.kind and
+// error tags, which spans keep in their Kind and Status fields, match
+// as they were set, so MatchTag("error", true) matches failed
+// operations.
+func MatchTag(key string, value interface{}) func(RawSpan) bool {
+	return func(sp RawSpan) bool {
+		v, ok := sp.Tags[key]
+		if !ok {
+			v, ok = promotedTag(sp, key)
+		}
+		return ok && v == value
+	}
+}
+
+// MatchStatus returns a function for Route.Match that matches spans
+// with the status code code. For example, MatchStatus(StatusError)
+// matches failed operations.
+func MatchStatus(code StatusCode) func(RawSpan) bool {
+	return func(sp RawSpan) bool {
+		return sp.Status.Code == code
+	}
+}
+
+// Multi is a Storer that forwards spans to multiple Storers, for
+// example to a server and to a local file. Destinations are isolated
+// from each other: an error in one doesn't prevent the others from
+// receiving the span.
+type Multi struct {
+	routes []Route
+}
+
+// NewMulti returns a new Multi that forwards spans according to
+// routes. Each span is forwarded to all matching routes.
+func NewMulti(routes ...Route) *Multi {
+	return &Multi{routes: routes}
+}
+
+type multiError []error
+
+func (errs multiError) Error() string {
+	var s []string
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+func (errs multiError) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// each calls fn for every route, turning panics into errors.
+func (m *Multi) each(fn func(r Route) error) error {
+	var errs multiError
+	for i, r := range m.routes {
+		err := func() (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = fmt.Errorf("panic: %v", v)
+				}
+			}()
+			return fn(r)
+		}()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("route %d: %s", i, err))
+		}
+	}
+	return errs.err()
+}
+
+// Store implements the tracer.Storer interface.
+func (m *Multi) Store(sp RawSpan) error {
+	return m.each(func(r Route) error {
+		if r.Match != nil && !r.Match(sp) {
+			return nil
+		}
+		return r.Storer.Store(sp)
+	})
+}
+
+// Flush implements the tracer.Flusher interface. It flushes all
+// destinations that implement Flusher.
+func (m *Multi) Flush() error {
+	return m.each(func(r Route) error {
+		if f, ok := r.Storer.(Flusher); ok {
+			return f.Flush()
+		}
+		return nil
+	})
+}
+
+// Close implements the tracer.Closer interface. It closes all
+// destinations that implement Closer and flushes the others.
+func (m *Multi) Close(ctx context.Context) error {
+	return m.each(func(r Route) error {
+		if c, ok := r.Storer.(Closer); ok {
+			return c.Close(ctx)
+		}
+		if f, ok := r.Storer.(Flusher); ok {
+			return f.Flush()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+package tracer
+
+import (
+	"errors"
+	"testing"
+)
+
+type memStorer struct {
+	spans   []RawSpan
+	err     error
+	flushed bool
+}
+
+func (m *memStorer) Store(sp RawSpan) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.spans = append(m.spans, sp)
+	return nil
+}
+
+func (m *memStorer) Flush() error {
+	m.flushed = true
+	return nil
+}
+
+func TestMulti(t *testing.T) {
+	all := &memStorer{}
+	errs := &memStorer{}
+	legacy := &memStorer{}
+	failing := &memStorer{err: errors.New("unavailable")}
+	m := NewMulti(
+		Route{Storer: failing},
+		Route{Storer: all},
+		Route{Storer: errs, Match: MatchStatus(StatusError)},
+		Route{Storer: legacy, Match: MatchTag("error", true)},
+	)
+
+	sp1 := RawSpan{SpanContext: SpanContext{TraceID: 1, SpanID: 1}}
+	sp2 := RawSpan{SpanContext: SpanContext{TraceID: 1, SpanID: 2}, Status: Status{Code: StatusError}}
+	for _, sp := range []RawSpan{sp1, sp2} {
+		if err := m.Store(sp); err == nil {
+			t.Error("expected error from failing route")
+		}
+	}
+	if len(all.spans) != 2 {
+		t.Errorf("got %d spans in catch-all route, want 2", len(all.spans))
+	}
+	if len(errs.spans) != 1 || errs.spans[0].SpanID != 2 {
+		t.Errorf("got %v in error route, want span 2", errs.spans)
+	}
+	if len(legacy.spans) != 1 || legacy.spans[0].SpanID != 2 {
+		t.Errorf("got %v in error tag route, want span 2", legacy.spans)
+	}
+
+	if err := m.Flush(); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	for i, s := range []*memStorer{failing, all, errs, legacy} {
+		if !s.flushed {
+			t.Errorf("route %d wasn't flushed", i)
+		}
+	}
+}
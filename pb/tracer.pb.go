@@ -12,6 +12,7 @@ It has these top-level messages:
 	Trace
 	Span
 	Tag
+	Process
 	StoreRequest
 	StoreResponse
 */
@@ -38,6 +39,65 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+// SpanKind describes the role of a span in a trace.
+type SpanKind int32
+
+const (
+	SpanKind_KIND_UNSPECIFIED SpanKind = 0
+	SpanKind_KIND_CLIENT      SpanKind = 1
+	SpanKind_KIND_SERVER      SpanKind = 2
+	SpanKind_KIND_PRODUCER    SpanKind = 3
+	SpanKind_KIND_CONSUMER    SpanKind = 4
+	SpanKind_KIND_INTERNAL    SpanKind = 5
+)
+
+var SpanKind_name = map[int32]string{
+	0: "KIND_UNSPECIFIED",
+	1: "KIND_CLIENT",
+	2: "KIND_SERVER",
+	3: "KIND_PRODUCER",
+	4: "KIND_CONSUMER",
+	5: "KIND_INTERNAL",
+}
+var SpanKind_value = map[string]int32{
+	"KIND_UNSPECIFIED": 0,
+	"KIND_CLIENT":      1,
+	"KIND_SERVER":      2,
+	"KIND_PRODUCER":    3,
+	"KIND_CONSUMER":    4,
+	"KIND_INTERNAL":    5,
+}
+
+func (x SpanKind) String() string {
+	return proto.EnumName(SpanKind_name, int32(x))
+}
+func (SpanKind) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+// StatusCode describes whether the operation of a span succeeded.
+type StatusCode int32
+
+const (
+	StatusCode_STATUS_UNSET StatusCode = 0
+	StatusCode_STATUS_OK    StatusCode = 1
+	StatusCode_STATUS_ERROR StatusCode = 2
+)
+
+var StatusCode_name = map[int32]string{
+	0: "STATUS_UNSET",
+	1: "STATUS_OK",
+	2: "STATUS_ERROR",
+}
+var StatusCode_value = map[string]int32{
+	"STATUS_UNSET": 0,
+	"STATUS_OK":    1,
+	"STATUS_ERROR": 2,
+}
+
+func (x StatusCode) String() string {
+	return proto.EnumName(StatusCode_name, int32(x))
+}
+func (StatusCode) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
 type Trace struct {
 }
 
@@ -47,15 +107,27 @@ func (*Trace) ProtoMessage()               {}
 func (*Trace) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
 type Span struct {
-	SpanId        uint64                     `protobuf:"varint,1,opt,name=span_id" json:"span_id,omitempty"`
-	ParentId      uint64                     `protobuf:"varint,2,opt,name=parent_id" json:"parent_id,omitempty"`
-	TraceId       uint64                     `protobuf:"varint,3,opt,name=trace_id" json:"trace_id,omitempty"`
-	ServiceName   string                     `protobuf:"bytes,4,opt,name=service_name" json:"service_name,omitempty"`
-	OperationName string                     `protobuf:"bytes,5,opt,name=operation_name" json:"operation_name,omitempty"`
-	StartTime     *google_protobuf.Timestamp `protobuf:"bytes,6,opt,name=start_time" json:"start_time,omitempty"`
-	FinishTime    *google_protobuf.Timestamp `protobuf:"bytes,7,opt,name=finish_time" json:"finish_time,omitempty"`
-	Flags         uint64                     `protobuf:"varint,8,opt,name=flags" json:"flags,omitempty"`
-	Tags          []*Tag                     `protobuf:"bytes,9,rep,name=tags" json:"tags,omitempty"`
+	SpanId        uint64 `protobuf:"varint,1,opt,name=span_id" json:"span_id,omitempty"`
+	ParentId      uint64 `protobuf:"varint,2,opt,name=parent_id" json:"parent_id,omitempty"`
+	TraceId       uint64 `protobuf:"varint,3,opt,name=trace_id" json:"trace_id,omitempty"`
+	ServiceName   string `protobuf:"bytes,4,opt,name=service_name" json:"service_name,omitempty"`
+	OperationName string `protobuf:"bytes,5,opt,name=operation_name" json:"operation_name,omitempty"`
+	// Deprecated: use start_time_unix_nano.
+	StartTime *google_protobuf.Timestamp `protobuf:"bytes,6,opt,name=start_time" json:"start_time,omitempty"`
+	// Deprecated: use finish_time_unix_nano.
+	FinishTime *google_protobuf.Timestamp `protobuf:"bytes,7,opt,name=finish_time" json:"finish_time,omitempty"`
+	Flags      uint64                     `protobuf:"varint,8,opt,name=flags" json:"flags,omitempty"`
+	Tags       []*Tag                     `protobuf:"bytes,9,rep,name=tags" json:"tags,omitempty"`
+	// The index plus one of the span's process in
+	// StoreRequest.processes, or 0 if the process is unknown.
+	ProcessIndex  uint32     `protobuf:"varint,10,opt,name=process_index" json:"process_index,omitempty"`
+	Kind          SpanKind   `protobuf:"varint,11,opt,name=kind,enum=SpanKind" json:"kind,omitempty"`
+	StatusCode    StatusCode `protobuf:"varint,12,opt,name=status_code,enum=StatusCode" json:"status_code,omitempty"`
+	StatusMessage string     `protobuf:"bytes,13,opt,name=status_message" json:"status_message,omitempty"`
+	// Times in nanoseconds since the Unix epoch. Servers fall back to
+	// start_time and finish_time if they are zero.
+	StartTimeUnixNano  uint64 `protobuf:"fixed64,14,opt,name=start_time_unix_nano" json:"start_time_unix_nano,omitempty"`
+	FinishTimeUnixNano uint64 `protobuf:"fixed64,15,opt,name=finish_time_unix_nano" json:"finish_time_unix_nano,omitempty"`
 }
 
 func (m *Span) Reset()                    { *m = Span{} }
@@ -87,8 +159,12 @@ func (m *Span) GetTags() []*Tag {
 type Tag struct {
 	Key string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
 	// FIXME support non-string values
-	Value string                     `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
-	Time  *google_protobuf.Timestamp `protobuf:"bytes,3,opt,name=time" json:"time,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	// Deprecated: use time_unix_nano.
+	Time *google_protobuf.Timestamp `protobuf:"bytes,3,opt,name=time" json:"time,omitempty"`
+	// The time of a log entry in nanoseconds since the Unix epoch, or 0
+	// for tags.
+	TimeUnixNano uint64 `protobuf:"fixed64,4,opt,name=time_unix_nano" json:"time_unix_nano,omitempty"`
 }
 
 func (m *Tag) Reset()                    { *m = Tag{} }
@@ -103,14 +179,34 @@ func (m *Tag) GetTime() *google_protobuf.Timestamp {
 	return nil
 }
 
+// Process describes the process that emitted spans, for example by
+// its hostname and version.
+type Process struct {
+	Tags []*Tag `protobuf:"bytes,1,rep,name=tags" json:"tags,omitempty"`
+}
+
+func (m *Process) Reset()                    { *m = Process{} }
+func (m *Process) String() string            { return proto.CompactTextString(m) }
+func (*Process) ProtoMessage()               {}
+func (*Process) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *Process) GetTags() []*Tag {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
 type StoreRequest struct {
 	Spans []*Span `protobuf:"bytes,1,rep,name=spans" json:"spans,omitempty"`
+	// The processes of the spans, each sent only once per request.
+	Processes []*Process `protobuf:"bytes,2,rep,name=processes" json:"processes,omitempty"`
 }
 
 func (m *StoreRequest) Reset()                    { *m = StoreRequest{} }
 func (m *StoreRequest) String() string            { return proto.CompactTextString(m) }
 func (*StoreRequest) ProtoMessage()               {}
-func (*StoreRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*StoreRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
 
 func (m *StoreRequest) GetSpans() []*Span {
 	if m != nil {
@@ -119,20 +215,30 @@ func (m *StoreRequest) GetSpans() []*Span {
 	return nil
 }
 
+func (m *StoreRequest) GetProcesses() []*Process {
+	if m != nil {
+		return m.Processes
+	}
+	return nil
+}
+
 type StoreResponse struct {
 }
 
 func (m *StoreResponse) Reset()                    { *m = StoreResponse{} }
 func (m *StoreResponse) String() string            { return proto.CompactTextString(m) }
 func (*StoreResponse) ProtoMessage()               {}
-func (*StoreResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*StoreResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
 
 func init() {
 	proto.RegisterType((*Trace)(nil), "Trace")
 	proto.RegisterType((*Span)(nil), "Span")
 	proto.RegisterType((*Tag)(nil), "Tag")
+	proto.RegisterType((*Process)(nil), "Process")
 	proto.RegisterType((*StoreRequest)(nil), "StoreRequest")
 	proto.RegisterType((*StoreResponse)(nil), "StoreResponse")
+	proto.RegisterEnum("SpanKind", SpanKind_name, SpanKind_value)
+	proto.RegisterEnum("StatusCode", StatusCode_name, StatusCode_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -147,6 +253,7 @@ const _ = grpc.SupportPackageIsVersion3
 
 type StorerClient interface {
 	Store(ctx context.Context, in *StoreRequest, opts ...grpc.CallOption) (*StoreResponse, error)
+	StoreStream(ctx context.Context, opts ...grpc.CallOption) (Storer_StoreStreamClient, error)
 }
 
 type storerClient struct {
@@ -166,10 +273,42 @@ func (c *storerClient) Store(ctx context.Context, in *StoreRequest, opts ...grpc
 	return out, nil
 }
 
+func (c *storerClient) StoreStream(ctx context.Context, opts ...grpc.CallOption) (Storer_StoreStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Storer_serviceDesc.Streams[0], c.cc, "/Storer/StoreStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storerStoreStreamClient{stream}
+	return x, nil
+}
+
+type Storer_StoreStreamClient interface {
+	Send(*StoreRequest) error
+	Recv() (*StoreResponse, error)
+	grpc.ClientStream
+}
+
+type storerStoreStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *storerStoreStreamClient) Send(m *StoreRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *storerStoreStreamClient) Recv() (*StoreResponse, error) {
+	m := new(StoreResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Storer service
 
 type StorerServer interface {
 	Store(context.Context, *StoreRequest) (*StoreResponse, error)
+	StoreStream(Storer_StoreStreamServer) error
 }
 
 func RegisterStorerServer(s *grpc.Server, srv StorerServer) {
@@ -194,6 +333,32 @@ func _Storer_Store_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Storer_StoreStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(StorerServer).StoreStream(&storerStoreStreamServer{stream})
+}
+
+type Storer_StoreStreamServer interface {
+	Send(*StoreResponse) error
+	Recv() (*StoreRequest, error)
+	grpc.ServerStream
+}
+
+type storerStoreStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *storerStoreStreamServer) Send(m *StoreResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *storerStoreStreamServer) Recv() (*StoreRequest, error) {
+	m := new(StoreRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Storer_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Storer",
 	HandlerType: (*StorerServer)(nil),
@@ -203,33 +368,56 @@ var _Storer_serviceDesc = grpc.ServiceDesc{
 			Handler:    _Storer_Store_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StoreStream",
+			Handler:       _Storer_StoreStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: fileDescriptor0,
 }
 
 func init() { proto.RegisterFile("tracer.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 325 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x84, 0x90, 0xcd, 0x6e, 0xea, 0x30,
-	0x10, 0x85, 0xc5, 0x4d, 0x02, 0x64, 0xf8, 0xbb, 0xb5, 0xaa, 0x2a, 0x62, 0x85, 0xa2, 0xaa, 0x62,
-	0xe5, 0x54, 0x74, 0xd9, 0x47, 0xe8, 0xae, 0xb0, 0x47, 0x86, 0x0e, 0xc6, 0x6a, 0x62, 0xbb, 0xb6,
-	0x83, 0xc4, 0x4b, 0xf7, 0x19, 0x6a, 0x3b, 0x45, 0x6d, 0x57, 0xac, 0x66, 0xf2, 0xc5, 0x67, 0xce,
-	0x99, 0x81, 0xb1, 0x33, 0x6c, 0x8f, 0x86, 0x6a, 0xa3, 0x9c, 0x9a, 0x3f, 0x73, 0xe1, 0x8e, 0xed,
-	0x8e, 0xee, 0x55, 0x53, 0x71, 0x55, 0x33, 0xc9, 0xab, 0xf8, 0x63, 0xd7, 0x1e, 0x2a, 0xed, 0xce,
-	0x1a, 0x6d, 0xe5, 0x44, 0x83, 0xd6, 0xb1, 0x46, 0xff, 0x74, 0x9d, 0xb8, 0x1c, 0x40, 0xb6, 0x09,
-	0xc3, 0xca, 0xcf, 0x1e, 0xa4, 0x6b, 0xcd, 0x24, 0x99, 0xc1, 0xc0, 0xfa, 0xba, 0x15, 0x6f, 0x45,
-	0x6f, 0xd1, 0x5b, 0xa6, 0xe4, 0x06, 0x72, 0xcd, 0x0c, 0x4a, 0x17, 0xd0, 0xbf, 0x88, 0xfe, 0xc3,
-	0x30, 0x46, 0x08, 0x24, 0x89, 0xe4, 0x16, 0xc6, 0x16, 0xcd, 0x49, 0x78, 0x26, 0x59, 0x83, 0x45,
-	0xea, 0x69, 0x4e, 0xee, 0x60, 0xaa, 0x34, 0x1a, 0xe6, 0x84, 0x92, 0x1d, 0xcf, 0x22, 0xa7, 0x00,
-	0x3e, 0x84, 0x71, 0xdb, 0x10, 0xa7, 0xe8, 0x7b, 0x36, 0x5a, 0xcd, 0x29, 0x57, 0x8a, 0xd7, 0x48,
-	0x2f, 0xe1, 0xe9, 0xe6, 0x92, 0x95, 0x54, 0x30, 0x3a, 0x08, 0x29, 0xec, 0xb1, 0x13, 0x0c, 0xae,
-	0x0a, 0x26, 0x90, 0x1d, 0x6a, 0xc6, 0x6d, 0x31, 0x8c, 0xe9, 0x08, 0xa4, 0x2e, 0x7c, 0xe5, 0x8b,
-	0xc4, 0x0b, 0x53, 0xba, 0x61, 0xbc, 0x7c, 0x81, 0xc4, 0x17, 0x32, 0x82, 0xe4, 0x1d, 0xcf, 0x71,
-	0xd5, 0x3c, 0xc8, 0x4e, 0xac, 0x6e, 0x31, 0xae, 0x99, 0x93, 0xa5, 0x97, 0x05, 0xbf, 0xe4, 0x9a,
-	0x5f, 0x79, 0x0f, 0xe3, 0xb5, 0x53, 0x06, 0x5f, 0xf1, 0xa3, 0xf5, 0xc8, 0x9f, 0x23, 0x0b, 0x47,
-	0xb4, 0x7e, 0x6e, 0x70, 0xcc, 0x68, 0x38, 0x6d, 0x39, 0x83, 0xc9, 0xf7, 0x2b, 0xab, 0x95, 0xb4,
-	0xb8, 0x7a, 0x84, 0x7e, 0x04, 0x86, 0x3c, 0x40, 0x16, 0x3b, 0x32, 0xa1, 0xbf, 0x07, 0xcd, 0xa7,
-	0xf4, 0x8f, 0x62, 0xd7, 0x8f, 0xe6, 0x4f, 0x5f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xac, 0xad, 0x33,
-	0xe1, 0x03, 0x02, 0x00, 0x00,
+	// 590 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x92, 0xc1, 0x6f, 0xda, 0x30,
+	0x14, 0xc6, 0x1b, 0x92, 0x00, 0x79, 0x21, 0x90, 0x5a, 0xb4, 0x8b, 0xba, 0x55, 0x8a, 0x38, 0x4c,
+	0x51, 0x0f, 0xa1, 0x62, 0xc7, 0x1d, 0xa6, 0x8a, 0x66, 0x12, 0x6a, 0x07, 0x55, 0x12, 0x76, 0x8d,
+	0x0c, 0xb8, 0x69, 0x54, 0xb0, 0xb3, 0xd8, 0xa9, 0x5a, 0xed, 0xef, 0xd8, 0xff, 0x3b, 0xd9, 0x50,
+	0xca, 0x76, 0xe9, 0xcd, 0xf9, 0xbd, 0xe7, 0xe7, 0xef, 0xfb, 0x5e, 0xa0, 0x23, 0x2a, 0xbc, 0x24,
+	0x55, 0x58, 0x56, 0x4c, 0xb0, 0xb3, 0xaf, 0x79, 0x21, 0x1e, 0xea, 0x45, 0xb8, 0x64, 0x9b, 0x61,
+	0xce, 0xd6, 0x98, 0xe6, 0x43, 0x55, 0x58, 0xd4, 0xf7, 0xc3, 0x52, 0xbc, 0x94, 0x84, 0x0f, 0x45,
+	0xb1, 0x21, 0x5c, 0xe0, 0x4d, 0xf9, 0x76, 0xda, 0x5e, 0x1e, 0xb4, 0xc0, 0x4c, 0xe5, 0xb0, 0xc1,
+	0x1f, 0x1d, 0x8c, 0xa4, 0xc4, 0x14, 0xf5, 0xa0, 0xc5, 0x4b, 0x4c, 0xb3, 0x62, 0xe5, 0x69, 0xbe,
+	0x16, 0x18, 0xe8, 0x18, 0xac, 0x12, 0x57, 0x84, 0x0a, 0x89, 0x1a, 0x0a, 0xb9, 0xd0, 0x56, 0x12,
+	0x24, 0xd1, 0x15, 0xe9, 0x43, 0x87, 0x93, 0xea, 0xa9, 0x58, 0x92, 0x8c, 0xe2, 0x0d, 0xf1, 0x0c,
+	0x5f, 0x0b, 0x2c, 0x74, 0x0a, 0x5d, 0x56, 0x92, 0x0a, 0x8b, 0x82, 0xd1, 0x2d, 0x37, 0x15, 0x0f,
+	0x01, 0xb8, 0xc0, 0x95, 0xc8, 0xa4, 0x1c, 0xaf, 0xe9, 0x6b, 0x81, 0x3d, 0x3a, 0x0b, 0x73, 0xc6,
+	0xf2, 0x35, 0x09, 0x5f, 0xc5, 0x87, 0xe9, 0xab, 0x56, 0x34, 0x04, 0xfb, 0xbe, 0xa0, 0x05, 0x7f,
+	0xd8, 0x5e, 0x68, 0xbd, 0x7b, 0xc1, 0x01, 0xf3, 0x7e, 0x8d, 0x73, 0xee, 0xb5, 0x95, 0x3a, 0x04,
+	0x86, 0x90, 0x5f, 0x96, 0xaf, 0x07, 0xf6, 0xc8, 0x08, 0x53, 0x9c, 0xa3, 0x13, 0x70, 0xca, 0x8a,
+	0x2d, 0x09, 0xe7, 0x59, 0x41, 0x57, 0xe4, 0xd9, 0x03, 0x5f, 0x0b, 0x1c, 0xf4, 0x01, 0x8c, 0xc7,
+	0x82, 0xae, 0x3c, 0xdb, 0xd7, 0x82, 0xee, 0xc8, 0x0a, 0x65, 0x26, 0x37, 0x05, 0x5d, 0x21, 0x1f,
+	0x6c, 0x2e, 0xb0, 0xa8, 0x79, 0xb6, 0x64, 0x2b, 0xe2, 0x75, 0x54, 0xdd, 0x0e, 0x13, 0xc5, 0xc6,
+	0x6c, 0x45, 0xa4, 0xdb, 0x5d, 0xc7, 0x86, 0x70, 0x8e, 0x73, 0xe2, 0x39, 0xca, 0xed, 0x27, 0xe8,
+	0xbf, 0xb9, 0xcd, 0x6a, 0x5a, 0x3c, 0x67, 0x14, 0x53, 0xe6, 0x75, 0x7d, 0x2d, 0x68, 0xa2, 0x73,
+	0x38, 0x39, 0xf0, 0x76, 0x50, 0xee, 0xc9, 0xf2, 0x60, 0x09, 0xba, 0x54, 0x6b, 0x83, 0xfe, 0x48,
+	0x5e, 0xd4, 0x46, 0x2c, 0xe9, 0xee, 0x09, 0xaf, 0x6b, 0xa2, 0xb6, 0x61, 0xa1, 0x00, 0x0c, 0x15,
+	0x8b, 0xfe, 0x6e, 0x2c, 0xa7, 0xd0, 0xfd, 0xef, 0x11, 0x43, 0x3d, 0x72, 0x0e, 0xad, 0xbb, 0x6d,
+	0x16, 0xfb, 0xa8, 0xb4, 0xb7, 0xa8, 0x06, 0x57, 0xd0, 0x49, 0x04, 0xab, 0x48, 0x4c, 0x7e, 0xd5,
+	0x84, 0x0b, 0xd4, 0x07, 0x53, 0xfe, 0x22, 0xaf, 0x4d, 0xa6, 0x0a, 0x09, 0x7d, 0x04, 0x6b, 0x17,
+	0x28, 0xe1, 0x5e, 0x43, 0x55, 0xda, 0xe1, 0x6e, 0xec, 0xa0, 0x07, 0xce, 0x6e, 0x04, 0x2f, 0x19,
+	0xe5, 0xe4, 0xe2, 0x37, 0xb4, 0xf7, 0xd1, 0xf6, 0xc1, 0xbd, 0x99, 0x4c, 0xaf, 0xb3, 0xf9, 0x34,
+	0xb9, 0x8b, 0xc6, 0x93, 0xef, 0x93, 0xe8, 0xda, 0x3d, 0x42, 0x3d, 0xb0, 0x15, 0x1d, 0xdf, 0x4e,
+	0xa2, 0x69, 0xea, 0x6a, 0x7b, 0x90, 0x44, 0xf1, 0xcf, 0x28, 0x76, 0x1b, 0xe8, 0x18, 0x1c, 0x05,
+	0xee, 0xe2, 0xd9, 0xf5, 0x7c, 0x1c, 0xc5, 0xae, 0xbe, 0x47, 0xe3, 0xd9, 0x34, 0x99, 0xff, 0x88,
+	0x62, 0xd7, 0xd8, 0xa3, 0xc9, 0x34, 0x8d, 0xe2, 0xe9, 0xd5, 0xad, 0x6b, 0x5e, 0x7c, 0x03, 0x38,
+	0xd8, 0x9b, 0x0b, 0x9d, 0x24, 0xbd, 0x4a, 0xe7, 0x89, 0x14, 0x10, 0xa5, 0xee, 0x11, 0x72, 0xc0,
+	0xda, 0x91, 0xd9, 0x8d, 0xab, 0x1d, 0x34, 0x44, 0x71, 0x3c, 0x8b, 0xdd, 0xc6, 0x68, 0x01, 0x4d,
+	0x65, 0xa7, 0x42, 0x9f, 0xc1, 0x54, 0x27, 0xe4, 0x84, 0x87, 0x19, 0x9d, 0x75, 0xc3, 0x7f, 0xfc,
+	0xa2, 0x4b, 0xb0, 0x15, 0x48, 0x44, 0x45, 0xf0, 0xe6, 0x9d, 0xee, 0x40, 0xbb, 0xd4, 0x16, 0x4d,
+	0xb5, 0xc0, 0x2f, 0x7f, 0x07, 0x00, 0x79, 0x05, 0xcb, 0xc5, 0xee, 0x03, 0x00, 0x00,
 }
@@ -0,0 +1,70 @@
+package tracer
+
+import (
+	"net"
+	"os"
+	"runtime/debug"
+	"strconv"
+)
+
+// A Process describes the process that emitted a span, for example
+// by its hostname and version. Spans of the same process share a
+// single Process, which storers send once per batch instead of once
+// per span.
+//
+// A Process must not be modified once it has been used by a tracer.
+type Process struct {
+	Tags map[string]string `json:"tags"`
+}
+
+// NewProcess returns a Process with tags that describe the current
+// process, as far as they can be detected:
+//
+//	hostname  the name of the host
+//	ip        the first non-loopback IP address of the host
+//	pid       the process ID
+//	version   the version of the main module of the binary
+//
+// The tags in custom are added to the detected ones, overriding them
+// where necessary.
+func NewProcess(custom map[string]string) *Process {
+	tags := map[string]string{
+		"pid": strconv.Itoa(os.Getpid()),
+	}
+	if host, err := os.Hostname(); err == nil {
+		tags["hostname"] = host
+	}
+	if ip := hostIP(); ip != "" {
+		tags["ip"] = ip
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		tags["version"] = info.Main.Version
+	}
+	for k, v := range custom {
+		tags[k] = v
+	}
+	return &Process{Tags: tags}
+}
+
+// hostIP returns the first non-loopback IP address of the host,
+// preferring IPv4 addresses.
+func hostIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	var ipv6 string
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip4 := ipnet.IP.To4(); ip4 != nil {
+			return ip4.String()
+		}
+		if ipv6 == "" {
+			ipv6 = ipnet.IP.String()
+		}
+	}
+	return ipv6
+}
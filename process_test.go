@@ -0,0 +1,35 @@
+package tracer
+
+import (
+	"testing"
+)
+
+func TestProtoBatchProcesses(t *testing.T) {
+	p1 := &Process{Tags: map[string]string{"hostname": "a"}}
+	p2 := &Process{Tags: map[string]string{"hostname": "b"}}
+	var batch []interface{}
+	for _, p := range []*Process{p1, nil, p2, p1} {
+		item, _, err := encodeProto(RawSpan{Process: p})
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		batch = append(batch, item)
+	}
+	req := protoBatch(batch)
+	if len(req.Processes) != 2 {
+		t.Fatalf("got %d processes, want 2", len(req.Processes))
+	}
+	var got []uint32
+	for _, sp := range req.Spans {
+		got = append(got, sp.ProcessIndex)
+	}
+	want := []uint32{1, 0, 2, 1}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got process indices %v, want %v", got, want)
+		}
+	}
+	if tag := req.Processes[1].Tags[0]; tag.Key != "hostname" || tag.Value != "b" {
+		t.Errorf("got tag %v for second process, want hostname=b", tag)
+	}
+}
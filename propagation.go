@@ -1,10 +1,10 @@
 package tracer
 
 import (
-	"encoding/binary"
-	"io"
+	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/opentracing/opentracing-go"
 )
@@ -15,28 +15,188 @@ type Extracter func(carrier interface{}) (SpanContext, error)
 // An Injecter injects a SpanContext into carrier.
 type Injecter func(sm SpanContext, carrier interface{}) error
 
-var extracters = map[interface{}]Extracter{
-	opentracing.HTTPHeaders: textExtracter,
-	opentracing.TextMap:     textExtracter,
-	opentracing.Binary:      binaryExtracter,
-}
+// Format is a propagation format implemented by this package, in
+// addition to the builtin formats of OpenTracing.
+type Format byte
 
-var injecters = map[interface{}]Injecter{
-	opentracing.HTTPHeaders: textInjecter,
-	opentracing.TextMap:     textInjecter,
-	opentracing.Binary:      binaryInjecter,
-}
+const (
+	// B3 propagates span contexts via Zipkin's multiple B3 headers,
+	// such as X-B3-TraceId and X-B3-SpanId. The carrier must be an
+	// opentracing.TextMapWriter or opentracing.TextMapReader.
+	//
+	// B3 doesn't support baggage.
+	B3 Format = iota
+	// B3Single propagates span contexts via Zipkin's single b3
+	// header. The carrier must be an opentracing.TextMapWriter or
+	// opentracing.TextMapReader.
+	B3Single
+	// Composite injects span contexts into all of the formats listed
+	// in a Tracer's CompositeFormats, and extracts them from the
+	// first of those formats that yields a valid span context. This
+	// is useful during migrations, when requests may carry headers in
+	// any of several formats. The carrier must be supported by all of
+	// the formats.
+	Composite
+	// LegacyBinary is the unversioned binary format used by earlier
+	// versions of Tracer. opentracing.Binary can extract it, but
+	// injects a newer format. Services that need to talk to older
+	// versions of Tracer can inject LegacyBinary instead. The carrier
+	// must be an io.Writer or io.Reader.
+	LegacyBinary
+	// Environment propagates span contexts to child processes via
+	// the TRACEPARENT and BAGGAGE environment variables. Injecting
+	// requires an *exec.Cmd or a *[]string carrier; if the command's
+	// Env is nil, it will be initialized with the current
+	// environment. Extracting requires a []string carrier, such as
+	// the one returned by os.Environ. Also see ExtractEnvironment.
+	Environment
+	// SQLComment appends a sqlcommenter-style comment containing the
+	// trace and span IDs, and the baggage, if any, to an SQL query, so
+	// that queries in database logs can be associated with traces. The carrier must be a
+	// *SQLCommentCarrier. Also see tracerutil.SQLComment.
+	SQLComment
+	// W3C propagates span contexts via the traceparent header of W3C
+	// Trace Context and the baggage header of W3C Baggage. The
+	// carrier must be an opentracing.TextMapWriter or
+	// opentracing.TextMapReader.
+	//
+	// The tracestate header isn't propagated.
+	W3C
+)
+
+// The default formats, available to all tracers. They can be
+// extended with RegisterExtracter and RegisterInjecter.
+var (
+	defaultsMu sync.RWMutex
+	extracters = map[interface{}]Extracter{
+		opentracing.HTTPHeaders: textExtracter,
+		opentracing.TextMap:     textExtracter,
+		opentracing.Binary:      binaryExtracter,
+		B3:                      b3Extracter,
+		B3Single:                b3SingleExtracter,
+		LegacyBinary:            legacyBinaryExtracter,
+		Environment:             envExtracter,
+		SQLComment:              sqlCommentExtracter,
+		W3C:                     w3cExtracter,
+	}
+	injecters = map[interface{}]Injecter{
+		opentracing.HTTPHeaders: textInjecter,
+		opentracing.TextMap:     textInjecter,
+		opentracing.Binary:      binaryInjecter,
+		B3:                      b3Injecter,
+		B3Single:                b3SingleInjecter,
+		LegacyBinary:            legacyBinaryInjecter,
+		Environment:             envInjecter,
+		SQLComment:              sqlCommentInjecter,
+		W3C:                     w3cInjecter,
+	}
+)
 
-// RegisterExtracter registers an Extracter.
+// RegisterExtracter registers a default Extracter, which will be
+// used by all tracers that haven't registered their own Extracter
+// for the format. It is safe to call concurrently with Extract.
 func RegisterExtracter(format interface{}, extracter Extracter) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
 	extracters[format] = extracter
 }
 
-// RegisterInjecter registers an Injecter.
+// RegisterInjecter registers a default Injecter, which will be used
+// by all tracers that haven't registered their own Injecter for the
+// format. It is safe to call concurrently with Inject.
 func RegisterInjecter(format interface{}, injecter Injecter) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
 	injecters[format] = injecter
 }
 
+// RegisterExtracter registers an Extracter for this tracer only,
+// overriding the default Extracter for the format, if any. It is
+// safe to call concurrently with Extract.
+func (tr *Tracer) RegisterExtracter(format interface{}, extracter Extracter) {
+	tr.propMu.Lock()
+	defer tr.propMu.Unlock()
+	if tr.extracters == nil {
+		tr.extracters = map[interface{}]Extracter{}
+	}
+	tr.extracters[format] = extracter
+}
+
+// RegisterInjecter registers an Injecter for this tracer only,
+// overriding the default Injecter for the format, if any. It is safe
+// to call concurrently with Inject.
+func (tr *Tracer) RegisterInjecter(format interface{}, injecter Injecter) {
+	tr.propMu.Lock()
+	defer tr.propMu.Unlock()
+	if tr.injecters == nil {
+		tr.injecters = map[interface{}]Injecter{}
+	}
+	tr.injecters[format] = injecter
+}
+
+func (tr *Tracer) extracter(format interface{}) (Extracter, bool) {
+	tr.propMu.RLock()
+	extracter, ok := tr.extracters[format]
+	tr.propMu.RUnlock()
+	if ok {
+		return extracter, true
+	}
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	extracter, ok = extracters[format]
+	return extracter, ok
+}
+
+func (tr *Tracer) injecter(format interface{}) (Injecter, bool) {
+	tr.propMu.RLock()
+	injecter, ok := tr.injecters[format]
+	tr.propMu.RUnlock()
+	if ok {
+		return injecter, true
+	}
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	injecter, ok = injecters[format]
+	return injecter, ok
+}
+
+func (tr *Tracer) injectComposite(sm SpanContext, carrier interface{}) error {
+	for _, format := range tr.CompositeFormats {
+		if format == Composite {
+			return opentracing.ErrUnsupportedFormat
+		}
+		injecter, ok := tr.injecter(format)
+		if !ok {
+			return opentracing.ErrUnsupportedFormat
+		}
+		if err := injecter(sm, carrier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tr *Tracer) extractComposite(carrier interface{}) (SpanContext, error) {
+	ret := opentracing.ErrSpanContextNotFound
+	for _, format := range tr.CompositeFormats {
+		if format == Composite {
+			return SpanContext{}, opentracing.ErrUnsupportedFormat
+		}
+		extracter, ok := tr.extracter(format)
+		if !ok {
+			return SpanContext{}, opentracing.ErrUnsupportedFormat
+		}
+		context, err := extracter(carrier)
+		if err == nil {
+			return context, nil
+		}
+		if ret == opentracing.ErrSpanContextNotFound {
+			ret = err
+		}
+	}
+	return SpanContext{}, ret
+}
+
 // SpanContext contains the parts of a span that will be sent to
 // downstream services.
 type SpanContext struct {
@@ -45,6 +205,17 @@ type SpanContext struct {
 	SpanID   uint64            `json:"span_id"`
 	Flags    uint64            `json:"flags"`
 	Baggage  map[string]string `json:"baggage"`
+
+	// untrusted marks span contexts that were extracted from an
+	// untrusted source and may only be used as links.
+	untrusted bool
+	// deferred marks span contexts whose sender left the sampling
+	// decision to the receiver, which makes it with its own sampler.
+	deferred bool
+	// The tracer that started the span of the context, if it was
+	// started in this process. Unsampled children of the tracer's own
+	// spans take a shortcut, see Tracer.unsampledChild.
+	tracer *Tracer
 }
 
 // ForeachBaggageItem implements the opentracing.Tracer interface.
@@ -102,72 +273,35 @@ func textExtracter(carrier interface{}) (SpanContext, error) {
 	return ctx, err
 }
 
-func binaryInjecter(sm SpanContext, carrier interface{}) error {
-	w, ok := carrier.(io.Writer)
-	if !ok {
-		return opentracing.ErrInvalidCarrier
+// formatTraceParent formats a span context in the format of the W3C
+// traceparent header. Trace IDs are padded to 128 bits.
+func formatTraceParent(sm SpanContext) string {
+	var flags uint64
+	if sm.Flags&FlagSampled > 0 {
+		flags = 1
 	}
-	b := make([]byte, 8*5)
-	binary.BigEndian.PutUint64(b, sm.TraceID)
-	binary.BigEndian.PutUint64(b[8:], sm.SpanID)
-	binary.BigEndian.PutUint64(b[16:], sm.ParentID)
-	binary.BigEndian.PutUint64(b[24:], sm.Flags)
-	binary.BigEndian.PutUint64(b[32:], uint64(len(sm.Baggage)))
-	for k, v := range sm.Baggage {
-		b2 := make([]byte, 16+len(k)+len(v))
-		binary.BigEndian.PutUint64(b2, uint64(len(k)))
-		binary.BigEndian.PutUint64(b2[8:], uint64(len(v)))
-		copy(b2[16:], k)
-		copy(b2[16+len(k):], v)
-		b = append(b, b2...)
-	}
-	_, err := w.Write(b)
-	return err
+	return fmt.Sprintf("00-%016x%016x-%016x-%02x", 0, sm.TraceID, sm.SpanID, flags)
 }
 
-func binaryExtracter(carrier interface{}) (SpanContext, error) {
-	r, ok := carrier.(io.Reader)
-	if !ok {
-		return SpanContext{}, opentracing.ErrInvalidCarrier
+// parseTraceParent parses a span context in the format of the W3C
+// traceparent header, version-traceid-parentid-flags. Only the lower
+// 64 bits of the trace ID are used.
+func parseTraceParent(s string) (SpanContext, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
 	}
 	ctx := SpanContext{Baggage: map[string]string{}}
-	b := make([]byte, 8*5)
-	if _, err := io.ReadFull(r, b); err != nil {
-		if err == io.ErrUnexpectedEOF {
-			return SpanContext{}, opentracing.ErrSpanContextNotFound
-		}
-		return SpanContext{}, err
-	}
-	ctx.TraceID = binary.BigEndian.Uint64(b)
-	ctx.SpanID = binary.BigEndian.Uint64(b[8:])
-	ctx.ParentID = binary.BigEndian.Uint64(b[16:])
-	ctx.Flags = binary.BigEndian.Uint64(b[24:])
-	n := binary.BigEndian.Uint64(b[32:])
-
-	b = make([]byte, 8*2)
-	for i := uint64(0); i < n; i++ {
-		if _, err := io.ReadFull(r, b); err != nil {
-			if err == io.ErrUnexpectedEOF {
-				return SpanContext{}, opentracing.ErrSpanContextNotFound
-			}
-			return SpanContext{}, err
-		}
-
-		kl := int(binary.BigEndian.Uint64(b))
-		vl := int(binary.BigEndian.Uint64(b[8:]))
-		if kl <= 0 || vl < 0 {
-			return SpanContext{}, opentracing.ErrSpanContextNotFound
-		}
-
-		b2 := make([]byte, kl+vl)
-		if _, err := io.ReadFull(r, b2); err != nil {
-			if err == io.ErrUnexpectedEOF {
-				return SpanContext{}, opentracing.ErrSpanContextNotFound
-			}
-			return SpanContext{}, err
-		}
-		ctx.Baggage[string(b2[:kl])] = string(b2[kl:])
+	var err1, err2, err3 error
+	var flags uint64
+	ctx.TraceID, err1 = strconv.ParseUint(parts[1][16:], 16, 64)
+	ctx.SpanID, err2 = strconv.ParseUint(parts[2], 16, 64)
+	flags, err3 = strconv.ParseUint(parts[3], 16, 8)
+	if err1 != nil || err2 != nil || err3 != nil || ctx.TraceID == 0 || ctx.SpanID == 0 {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	if flags&1 > 0 {
+		ctx.Flags |= FlagSampled
 	}
-
 	return ctx, nil
 }
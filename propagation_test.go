@@ -2,7 +2,14 @@ package tracer
 
 import (
 	"bytes"
+	"encoding/binary"
+	"io"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 )
@@ -81,3 +88,553 @@ func TestBinary(t *testing.T) {
 			sp.raw.TraceID, sp.raw.ParentID, sp.raw.SpanID, sp.raw.Flags, sp.raw.Baggage)
 	}
 }
+
+func TestB3(t *testing.T) {
+	want := SpanContext{
+		SpanID:   1,
+		ParentID: 2,
+		TraceID:  3,
+		Flags:    FlagSampled | FlagDebug,
+	}
+	for _, format := range []Format{B3, B3Single} {
+		carrier := opentracing.TextMapCarrier{}
+		if err := injecters[format](want, carrier); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		context, err := extracters[format](carrier)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if context.TraceID != want.TraceID ||
+			context.ParentID != want.ParentID ||
+			context.SpanID != want.SpanID ||
+			context.Flags != want.Flags {
+
+			t.Errorf("got (%d, %d, %d, %d), want (%d, %d, %d, %d)",
+				context.TraceID, context.ParentID, context.SpanID, context.Flags,
+				want.TraceID, want.ParentID, want.SpanID, want.Flags)
+		}
+	}
+}
+
+func TestB3Extract(t *testing.T) {
+	tests := []struct {
+		format  Format
+		headers map[string]string
+		want    SpanContext
+		ok      bool
+	}{
+		{
+			B3,
+			map[string]string{
+				"X-B3-TraceId": "463ac35c9f6413ad48485a3953bb6124",
+				"X-B3-SpanId":  "a2fb4a1d1a96d312",
+				"X-B3-Sampled": "1",
+			},
+			SpanContext{TraceID: 0x48485a3953bb6124, SpanID: 0xa2fb4a1d1a96d312, Flags: FlagSampled},
+			true,
+		},
+		{
+			B3,
+			map[string]string{
+				"X-B3-TraceId": "463ac35c9f6413ad",
+				"X-B3-SpanId":  "a2fb4a1d1a96d312",
+				"X-B3-Sampled": "0",
+			},
+			SpanContext{TraceID: 0x463ac35c9f6413ad, SpanID: 0xa2fb4a1d1a96d312},
+			true,
+		},
+		{
+			B3,
+			map[string]string{
+				"X-B3-TraceId": "463ac35c9f6413ad",
+				"X-B3-SpanId":  "a2fb4a1d1a96d312",
+			},
+			SpanContext{TraceID: 0x463ac35c9f6413ad, SpanID: 0xa2fb4a1d1a96d312, deferred: true},
+			true,
+		},
+		{
+			B3,
+			map[string]string{
+				"X-B3-TraceId": "not hex",
+				"X-B3-SpanId":  "a2fb4a1d1a96d312",
+			},
+			SpanContext{},
+			false,
+		},
+		{
+			B3Single,
+			map[string]string{"b3": "463ac35c9f6413ad-a2fb4a1d1a96d312-d-0020000000000001"},
+			SpanContext{TraceID: 0x463ac35c9f6413ad, SpanID: 0xa2fb4a1d1a96d312, ParentID: 0x20000000000001, Flags: FlagSampled | FlagDebug},
+			true,
+		},
+		{
+			B3Single,
+			map[string]string{"b3": "463ac35c9f6413ad-a2fb4a1d1a96d312"},
+			SpanContext{TraceID: 0x463ac35c9f6413ad, SpanID: 0xa2fb4a1d1a96d312, deferred: true},
+			true,
+		},
+		{
+			B3Single,
+			map[string]string{"b3": "0"},
+			SpanContext{},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		context, err := extracters[tt.format](opentracing.TextMapCarrier(tt.headers))
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: got error %v, want success %t", tt.headers, err, tt.ok)
+			continue
+		}
+		if context.TraceID != tt.want.TraceID ||
+			context.ParentID != tt.want.ParentID ||
+			context.SpanID != tt.want.SpanID ||
+			context.Flags != tt.want.Flags ||
+			context.deferred != tt.want.deferred {
+
+			t.Errorf("%v: got (%d, %d, %d, %d, %t), want (%d, %d, %d, %d, %t)", tt.headers,
+				context.TraceID, context.ParentID, context.SpanID, context.Flags, context.deferred,
+				tt.want.TraceID, tt.want.ParentID, tt.want.SpanID, tt.want.Flags, tt.want.deferred)
+		}
+	}
+}
+
+func TestB3Deferred(t *testing.T) {
+	tests := []struct {
+		sampled string
+		sampler bool
+		want    bool
+	}{
+		{"", true, true},
+		{"", false, false},
+		{"0", true, false},
+		{"1", false, true},
+	}
+	for _, tt := range tests {
+		tr := NewTracer("", nil, RandomID{})
+		tr.Sampler = NewConstSampler(tt.sampler)
+		headers := opentracing.TextMapCarrier{
+			"X-B3-TraceId": "463ac35c9f6413ad",
+			"X-B3-SpanId":  "a2fb4a1d1a96d312",
+		}
+		if tt.sampled != "" {
+			headers["X-B3-Sampled"] = tt.sampled
+		}
+		parent, err := tr.Extract(B3, headers)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		sp := tr.StartSpan("op", opentracing.ChildOf(parent))
+		if got := sp.(*Span).Sampled(); got != tt.want {
+			t.Errorf("sampled header %q with sampler %t: got sampled %t, want %t", tt.sampled, tt.sampler, got, tt.want)
+		}
+
+		carrier := opentracing.TextMapCarrier{}
+		if err := tr.Inject(parent, B3, carrier); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if _, ok := carrier[b3Sampled]; ok != (tt.sampled != "") {
+			t.Errorf("sampled header %q: got re-injected headers %v", tt.sampled, carrier)
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+	tr := NewTracer("", nil, RandomID{})
+	tr.CompositeFormats = []interface{}{opentracing.TextMap, W3C, B3}
+	want := SpanContext{
+		SpanID:  1,
+		TraceID: 3,
+		Flags:   FlagSampled,
+		Baggage: map[string]string{"k": "v w", "k+": "a+b=c,d"},
+	}
+
+	carrier := opentracing.TextMapCarrier{}
+	if err := tr.Inject(want, Composite, carrier); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if carrier["tracer-traceid"] == "" || carrier["traceparent"] == "" || carrier["x-b3-traceid"] == "" {
+		t.Errorf("expected headers of all formats, got %v", carrier)
+	}
+	if strings.ContainsAny(carrier["baggage"], "+ ") {
+		t.Errorf("got baggage header %q, want percent-encoding only", carrier["baggage"])
+	}
+	context, err := tr.Extract(W3C, carrier)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if got := context.(SpanContext).Baggage; !reflect.DeepEqual(got, want.Baggage) {
+		t.Errorf("got baggage %v from W3C round trip, want %v", got, want.Baggage)
+	}
+
+	// Only B3 headers
+	carrier = opentracing.TextMapCarrier{}
+	if err := tr.Inject(want, B3, carrier); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	context, err = tr.Extract(Composite, carrier)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if context.(SpanContext).TraceID != want.TraceID {
+		t.Errorf("got trace ID %d, want %d", context.(SpanContext).TraceID, want.TraceID)
+	}
+
+	// Only W3C headers, as sent by other tracers
+	carrier = opentracing.TextMapCarrier{
+		"Traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"Tracestate":  "congo=t61rcWkgMzE",
+		"Baggage":     "k=v%20w;prop=1, other=1, plus=a+b",
+	}
+	context, err = tr.Extract(Composite, carrier)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	sc := context.(SpanContext)
+	if sc.TraceID != 0x8448eb211c80319c || sc.SpanID != 0xb7ad6b7169203331 || sc.Flags != FlagSampled {
+		t.Errorf("got (%x, %x, %d) from W3C headers", sc.TraceID, sc.SpanID, sc.Flags)
+	}
+	if sc.Baggage["k"] != "v w" || sc.Baggage["other"] != "1" || sc.Baggage["plus"] != "a+b" {
+		t.Errorf("got baggage %v from W3C headers", sc.Baggage)
+	}
+	if f := NewTracer("", nil, RandomID{}).CompositeFormats; len(f) != 3 || f[1] != W3C {
+		t.Errorf("got default composite formats %v, want W3C among them", f)
+	}
+
+	if _, err := tr.Extract(Composite, opentracing.TextMapCarrier{}); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("got error %v, want %v", err, opentracing.ErrSpanContextNotFound)
+	}
+}
+
+func TestTracerFormats(t *testing.T) {
+	type format struct{}
+	tr1 := NewTracer("", nil, RandomID{})
+	tr2 := NewTracer("", nil, RandomID{})
+	tr1.RegisterInjecter(opentracing.TextMap, b3Injecter)
+
+	carrier := opentracing.TextMapCarrier{}
+	if err := tr1.Inject(SpanContext{TraceID: 1, SpanID: 1}, opentracing.TextMap, carrier); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if _, ok := carrier["x-b3-traceid"]; !ok {
+		t.Errorf("expected tracer-specific injecter to be used, got %v", carrier)
+	}
+	carrier = opentracing.TextMapCarrier{}
+	if err := tr2.Inject(SpanContext{TraceID: 1, SpanID: 1}, opentracing.TextMap, carrier); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if _, ok := carrier["tracer-traceid"]; !ok {
+		t.Errorf("expected default injecter to be used, got %v", carrier)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			tr1.RegisterExtracter(format{}, textExtracter)
+			RegisterExtracter(format{}, textExtracter)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		_, _ = tr1.Extract(format{}, opentracing.TextMapCarrier{})
+		_, _ = tr2.Extract(format{}, opentracing.TextMapCarrier{})
+	}
+	<-done
+}
+
+func TestBinaryLegacy(t *testing.T) {
+	want := SpanContext{
+		SpanID:   1,
+		ParentID: 2,
+		TraceID:  3,
+		Flags:    FlagSampled,
+		Baggage:  map[string]string{"k1": "v1"},
+	}
+	buf := &bytes.Buffer{}
+	if err := legacyBinaryInjecter(want, buf); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	context, err := binaryExtracter(buf)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if context.TraceID != want.TraceID ||
+		context.ParentID != want.ParentID ||
+		context.SpanID != want.SpanID ||
+		context.Flags != want.Flags ||
+		len(context.Baggage) != 1 ||
+		context.Baggage["k1"] != "v1" {
+
+		t.Errorf("got (%d, %d, %d, %d, %v), want (%d, %d, %d, %d, %v)",
+			context.TraceID, context.ParentID, context.SpanID, context.Flags, context.Baggage,
+			want.TraceID, want.ParentID, want.SpanID, want.Flags, want.Baggage)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += n
+	return n, err
+}
+
+func TestBinaryLimits(t *testing.T) {
+	// A legacy header claiming a single baggage item with a 1 GB key.
+	b := make([]byte, 8*7)
+	binary.BigEndian.PutUint64(b, 3)
+	binary.BigEndian.PutUint64(b[32:], 1)
+	binary.BigEndian.PutUint64(b[40:], 1<<30)
+	if _, err := binaryExtracter(bytes.NewReader(b)); err != opentracing.ErrSpanContextCorrupted {
+		t.Errorf("got error %v, want %v", err, opentracing.ErrSpanContextCorrupted)
+	}
+
+	// Baggage beyond the limits is dropped, but the span context is
+	// kept.
+	baggage := map[string]string{}
+	for i := 0; i <= maxBinaryBaggageItems; i++ {
+		baggage[strconv.Itoa(i)] = ""
+	}
+	for _, inject := range []Injecter{binaryInjecter, legacyBinaryInjecter} {
+		buf := &bytes.Buffer{}
+		if err := inject(SpanContext{TraceID: 3, Baggage: baggage}, buf); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		ctx, err := binaryExtracter(buf)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if ctx.TraceID != 3 || len(ctx.Baggage) != maxBinaryBaggageItems {
+			t.Errorf("got trace ID %d and %d baggage items, want 3 and %d", ctx.TraceID, len(ctx.Baggage), maxBinaryBaggageItems)
+		}
+
+		buf.Reset()
+		big := string(make([]byte, maxBinaryBaggageSize))
+		if err := inject(SpanContext{TraceID: 3, Baggage: map[string]string{"k": big, "small": "v"}}, buf); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		ctx, err = binaryExtracter(buf)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if ctx.TraceID != 3 || len(ctx.Baggage) != 1 || ctx.Baggage["small"] != "v" {
+			t.Errorf("got trace ID %d and baggage %v, want 3 and only the small item", ctx.TraceID, ctx.Baggage)
+		}
+	}
+
+	// Extracting reads a bounded amount of data, even from endless
+	// streams, no matter whether they claim huge strings or many
+	// small ones.
+	for _, l := range []uint64{1 << 62, maxBinaryBaggageSize} {
+		header := append([]byte(binaryMagic), binaryVersion, 3, 0, 0, 0)
+		header = appendUvarint(header, 1<<62)
+		header = appendUvarint(header, l)
+		r := &countingReader{r: io.MultiReader(bytes.NewReader(header), zeroReader{})}
+		if _, err := binaryExtracter(r); err != opentracing.ErrSpanContextCorrupted {
+			t.Errorf("got error %v for string length %d, want %v", err, l, opentracing.ErrSpanContextCorrupted)
+		}
+		if r.n > len(header)+maxBinaryBaggageRead {
+			t.Errorf("read %d bytes for string length %d", r.n, l)
+		}
+	}
+
+	// A legacy header whose trace ID starts like the magic value of
+	// an earlier version of the format.
+	buf := &bytes.Buffer{}
+	want := SpanContext{TraceID: 0xff54520000000001, SpanID: 2}
+	if err := legacyBinaryInjecter(want, buf); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if ctx, err := binaryExtracter(buf); err != nil || ctx.TraceID != want.TraceID || ctx.SpanID != want.SpanID {
+		t.Errorf("got %+v, %v, want %+v", ctx, err, want)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	want := SpanContext{
+		SpanID:  1,
+		TraceID: 3,
+		Flags:   FlagSampled,
+		Baggage: map[string]string{"k1": "v1", "k,2": "v=2"},
+	}
+	cmd := exec.Command("true")
+	cmd.Env = []string{"PATH=/bin", "TRACEPARENT=stale"}
+	if err := envInjecter(want, cmd); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if len(cmd.Env) != 3 || cmd.Env[0] != "PATH=/bin" {
+		t.Errorf("unexpected environment %v", cmd.Env)
+	}
+	context, err := envExtracter(cmd.Env)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if context.TraceID != want.TraceID ||
+		context.SpanID != want.SpanID ||
+		context.Flags != want.Flags ||
+		len(context.Baggage) != 2 ||
+		context.Baggage["k1"] != "v1" ||
+		context.Baggage["k,2"] != "v=2" {
+
+		t.Errorf("got (%d, %d, %d, %v), want (%d, %d, %d, %v)",
+			context.TraceID, context.SpanID, context.Flags, context.Baggage,
+			want.TraceID, want.SpanID, want.Flags, want.Baggage)
+	}
+
+	if _, err := envExtracter([]string{"PATH=/bin"}); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("got error %v, want %v", err, opentracing.ErrSpanContextNotFound)
+	}
+}
+
+func TestSQLComment(t *testing.T) {
+	want := SpanContext{
+		SpanID:  1,
+		TraceID: 3,
+		Flags:   FlagSampled,
+	}
+	carrier := &SQLCommentCarrier{
+		Query:       "SELECT * FROM t WHERE s = 'a';",
+		ServiceName: "o'brien service",
+	}
+	if err := sqlCommentInjecter(want, carrier); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	const query = `SELECT * FROM t WHERE s = 'a' /*application='o%27brien%20service',traceparent='00-00000000000000000000000000000003-0000000000000001-01'*/;`
+	if carrier.Query != query {
+		t.Errorf("got query %q, want %q", carrier.Query, query)
+	}
+
+	carrier.ServiceName = ""
+	context, err := sqlCommentExtracter(carrier)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if context.TraceID != want.TraceID ||
+		context.SpanID != want.SpanID ||
+		context.Flags != want.Flags ||
+		carrier.ServiceName != "o'brien service" {
+
+		t.Errorf("got (%d, %d, %d, %q), want (%d, %d, %d, %q)",
+			context.TraceID, context.SpanID, context.Flags, carrier.ServiceName,
+			want.TraceID, want.SpanID, want.Flags, "o'brien service")
+	}
+
+	stripped, _ := ParseSQLComment(carrier.Query)
+	if stripped != "SELECT * FROM t WHERE s = 'a';" {
+		t.Errorf("got stripped query %q", stripped)
+	}
+	if q, kvs := ParseSQLComment("SELECT 1 /* hint */"); q != "SELECT 1 /* hint */" || kvs != nil {
+		t.Errorf("got (%q, %v) for a query without sqlcommenter comment", q, kvs)
+	}
+}
+
+func TestTrustPolicy(t *testing.T) {
+	key := []byte("secret")
+	internal := NewTracer("internal", nil, RandomID{})
+	internal.TrustPolicy = &TrustPolicy{Key: key}
+	edge := NewTracer("edge", nil, RandomID{})
+	edge.Sampler = NewConstSampler(false)
+	edge.TrustPolicy = &TrustPolicy{Key: key, StripBaggage: true}
+
+	remote := SpanContext{
+		SpanID:  1,
+		TraceID: 3,
+		Flags:   FlagSampled,
+		Baggage: map[string]string{"k1": "v1"},
+	}
+
+	// Signed contexts are trusted.
+	carrier := opentracing.TextMapCarrier{}
+	if err := internal.Inject(remote, opentracing.TextMap, carrier); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	context, err := edge.Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	sp := edge.StartSpan("op", opentracing.ChildOf(context)).(*Span)
+	if sp.raw.TraceID != remote.TraceID || !sp.Sampled() || sp.BaggageItem("k1") != "v1" {
+		t.Errorf("trusted context wasn't honored: %+v", sp.raw)
+	}
+	if _, ok := sp.raw.Baggage[signatureKey]; ok {
+		t.Error("signature leaked into baggage")
+	}
+
+	// Signatures survive all formats, even those that don't carry
+	// the parent ID or all flags.
+	var env []string
+	formats := []struct {
+		format  interface{}
+		carrier interface{}
+	}{
+		{W3C, opentracing.TextMapCarrier{}},
+		{Environment, &env},
+		{SQLComment, &SQLCommentCarrier{Query: "SELECT 1"}},
+	}
+	for _, f := range formats {
+		signed := remote
+		signed.ParentID = 2
+		signed.Flags |= FlagDebug
+		if err := internal.Inject(signed, f.format, f.carrier); err != nil {
+			t.Fatalf("unexpected error injecting %v: %s", f.format, err)
+		}
+		carrier := f.carrier
+		if f.format == Environment {
+			carrier = env
+		}
+		context, err := edge.Extract(f.format, carrier)
+		if err != nil {
+			t.Fatalf("unexpected error extracting %v: %s", f.format, err)
+		}
+		if sc := context.(SpanContext); sc.untrusted || sc.Baggage["k1"] != "v1" {
+			t.Errorf("signed context wasn't trusted in format %v: %+v", f.format, sc)
+		}
+	}
+
+	// Tampering invalidates the signature, causing a new root span.
+	carrier["tracer-flags"] = "0"
+	context, err = edge.Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	sp = edge.StartSpan("op", opentracing.ChildOf(context)).(*Span)
+	if sp.raw.TraceID == remote.TraceID || sp.raw.ParentID != 0 || sp.Sampled() || len(sp.raw.Baggage) != 0 {
+		t.Errorf("untrusted context was honored: %+v", sp.raw)
+	}
+	if sp.raw.Tags["link.trace_id"] != idToHex(remote.TraceID) || sp.raw.Tags["link.span_id"] != idToHex(remote.SpanID) {
+		t.Errorf("expected link to remote span, got tags %v", sp.raw.Tags)
+	}
+
+	// Expired signatures aren't trusted, so that captured span
+	// contexts can't be replayed indefinitely.
+	signed := remote
+	signed.Baggage = map[string]string{
+		"k1":         "v1",
+		signatureKey: edge.TrustPolicy.sign(remote, time.Now().Add(-time.Minute).Unix()),
+	}
+	if context, err := edge.TrustPolicy.check(signed); err != nil || !context.untrusted {
+		t.Errorf("expired signature was trusted: %+v, %v", context, err)
+	}
+	signed.Baggage[signatureKey] = edge.TrustPolicy.sign(remote, time.Now().Add(time.Minute).Unix())
+	if context, err := edge.TrustPolicy.check(signed); err != nil || context.untrusted {
+		t.Errorf("valid signature wasn't trusted: %+v, %v", context, err)
+	}
+
+	edge.TrustPolicy.Untrusted = Ignore
+	if _, err := edge.Extract(opentracing.TextMap, carrier); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("got error %v, want %v", err, opentracing.ErrSpanContextNotFound)
+	}
+}
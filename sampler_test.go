@@ -107,6 +107,41 @@ func TestForcedSample(t *testing.T) {
 	}
 }
 
+func TestSamplingPriority(t *testing.T) {
+	storer := &memStorer{}
+	tr := NewTracer("", storer, RandomID{})
+	tr.Sampler = NewConstSampler(false)
+
+	root := tr.StartSpan("root")
+	before := tr.StartSpan("before", opentracing.ChildOf(root.Context()))
+	ext.SamplingPriority.Set(root, 1)
+	after := tr.StartSpan("after", opentracing.ChildOf(root.Context()))
+	if before.(*Span).Sampled() || !after.(*Span).Sampled() {
+		t.Errorf("sampling priority didn't propagate to later children only")
+	}
+
+	child := tr.StartSpan("child", opentracing.ChildOf(after.Context()), opentracing.Tags{string(ext.SamplingPriority): 0})
+	if child.(*Span).Sampled() {
+		t.Errorf("child was sampled despite a priority of 0")
+	}
+	after.SetTag(string(ext.SamplingPriority), int64(0))
+	child.SetTag(string(ext.SamplingPriority), 2)
+
+	for _, sp := range []opentracing.Span{root, before, after, child} {
+		sp.Finish()
+	}
+	var got []string
+	for _, sp := range storer.spans {
+		got = append(got, sp.OperationName)
+		if _, ok := sp.Tags[string(ext.SamplingPriority)]; ok {
+			t.Errorf("sampling priority was stored as a tag")
+		}
+	}
+	if len(got) != 2 || got[0] != "root" || got[1] != "child" {
+		t.Errorf("got stored spans %v, want [root child]", got)
+	}
+}
+
 func TestSamplerUse(t *testing.T) {
 	tr := &Tracer{}
 	tr.Sampler = NewConstSampler(true)
@@ -158,6 +158,34 @@ func (errs errors) Error() string {
 	return strings.Join(s, "\n")
 }
 
+// Store normalizes a span received by a storage transport and stores
+// it in the storage. Storage transports should use it instead of
+// calling the storage directly.
+func (srv *Server) Store(sp tracer.RawSpan) error {
+	normalizeSQL(&sp)
+	return srv.Storage.Store(sp)
+}
+
+// normalizeSQL strips sqlcommenter-style comments, as injected by
+// the SQLComment format, from the sql.query tag and stores their
+// key/value pairs as sql.comment.* tags. This way, spans can be
+// queried both by the plain query and by the information found in
+// database logs.
+func normalizeSQL(sp *tracer.RawSpan) {
+	query, ok := sp.Tags["sql.query"].(string)
+	if !ok {
+		return
+	}
+	query, kvs := tracer.ParseSQLComment(query)
+	if kvs == nil {
+		return
+	}
+	sp.Tags["sql.query"] = query
+	for k, v := range kvs {
+		sp.Tags["sql.comment."+k] = v
+	}
+}
+
 func (srv *Server) Start() error {
 	errs := make(chan error)
 	go func() {
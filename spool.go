@@ -0,0 +1,128 @@
+package tracer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	spoolExt = ".spool"
+	tmpExt   = ".tmp"
+)
+
+type spoolFile struct {
+	name string
+	size int64
+}
+
+// spool is a bounded, on-disk FIFO queue of serialized batches. Each
+// batch is stored in its own file, named after a sequence number.
+// Because the files persist, batches survive process restarts. A
+// directory must only be used by one spool at a time.
+type spool struct {
+	dir     string
+	maxSize int64
+	size    int64
+	seq     uint64
+	files   []spoolFile
+}
+
+// openSpool opens the spool in dir, creating the directory if
+// necessary and picking up batches spooled by earlier processes.
+// Temporary files left behind by processes that crashed while
+// spooling are removed.
+func openSpool(dir string, maxSize int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &spool{dir: dir, maxSize: maxSize}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() && strings.HasSuffix(name, spoolExt+tmpExt) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		if info.IsDir() || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+		s.files = append(s.files, spoolFile{name, info.Size()})
+		s.size += info.Size()
+	}
+	// The sequence numbers are zero-padded, so lexical order is
+	// numerical order.
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+	return s, nil
+}
+
+func (s *spool) len() int {
+	return len(s.files)
+}
+
+// push appends a batch to the spool. If the spool would exceed its
+// maximum size, the oldest batches are discarded. It returns the
+// number of discarded batches.
+func (s *spool) push(b []byte) (int, error) {
+	if int64(len(b)) > s.maxSize {
+		return 0, fmt.Errorf("batch of %d bytes exceeds spool size of %d bytes", len(b), s.maxSize)
+	}
+	discarded := 0
+	for s.size+int64(len(b)) > s.maxSize {
+		if err := s.pop(); err != nil {
+			return discarded, err
+		}
+		discarded++
+	}
+
+	name := fmt.Sprintf("%020d%s", s.seq, spoolExt)
+	s.seq++
+	// Write to a temporary file first, so that a crash can't leave a
+	// truncated batch behind.
+	tmp := filepath.Join(s.dir, name+tmpExt)
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		_ = os.Remove(tmp)
+		return discarded, err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		return discarded, err
+	}
+	s.files = append(s.files, spoolFile{name, int64(len(b))})
+	s.size += int64(len(b))
+	return discarded, nil
+}
+
+// peek returns the oldest batch.
+func (s *spool) peek() ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.dir, s.files[0].name))
+}
+
+// pop removes the oldest batch. The batch is removed from the spool
+// even if deleting its file fails, so that the spool can't get stuck
+// on it.
+func (s *spool) pop() error {
+	f := s.files[0]
+	s.files = s.files[1:]
+	s.size -= f.size
+	if err := os.Remove(filepath.Join(s.dir, f.name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
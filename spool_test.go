@@ -0,0 +1,65 @@
+package tracer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracer-spool")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A batch that a crashed process didn't finish spooling.
+	tmp := filepath.Join(dir, "00000000000000000007.spool.tmp")
+	if err := ioutil.WriteFile(tmp, make([]byte, 10), 0600); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	s, err := openSpool(dir, 10)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temporary file wasn't removed: %v", err)
+	}
+	for _, b := range []string{"aaaa", "bbbb", "cccc"} {
+		if _, err := s.push([]byte(b)); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	}
+	if _, err := s.push(make([]byte, 11)); err == nil {
+		t.Error("expected error for batch larger than spool")
+	}
+
+	// Reopening the spool must pick up the batches that fit, oldest
+	// first.
+	s, err = openSpool(dir, 10)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	var got []string
+	for s.len() > 0 {
+		b, err := s.peek()
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		got = append(got, string(b))
+		if err := s.pop(); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	}
+	if len(got) != 2 || got[0] != "bbbb" || got[1] != "cccc" {
+		t.Errorf("got %q, want [bbbb cccc]", got)
+	}
+	if _, err := s.push([]byte("dddd")); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if s.files[0].name != "00000000000000000003.spool" {
+		t.Errorf("got file %s, want sequence number 3", s.files[0].name)
+	}
+}
@@ -0,0 +1,155 @@
+package tracer
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// SQLCommentCarrier is the carrier of the SQLComment format.
+type SQLCommentCarrier struct {
+	// The SQL query. Injecting appends a comment to it, extracting
+	// parses the comment.
+	Query string
+	// The name of the service that issues the query. Injecting
+	// includes it in the comment, extracting sets it.
+	ServiceName string
+}
+
+// The keys used in SQL comments. They follow the sqlcommenter
+// conventions.
+const (
+	sqlApplication = "application"
+	sqlTraceParent = "traceparent"
+	sqlBaggage     = "baggage"
+)
+
+func sqlEscape(s string) string {
+	s = strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+	return strings.Replace(s, "'", `\'`, -1)
+}
+
+func sqlUnescape(s string) string {
+	s = strings.Replace(s, `\'`, "'", -1)
+	out, err := url.QueryUnescape(s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+func sqlCommentInjecter(sm SpanContext, carrier interface{}) error {
+	c, ok := carrier.(*SQLCommentCarrier)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	query := strings.TrimRight(c.Query, " \t\n")
+	if strings.HasSuffix(query, "*/") {
+		// Don't add a second comment to a query that already has one.
+		return nil
+	}
+	kvs := map[string]string{
+		sqlTraceParent: formatTraceParent(sm),
+	}
+	if c.ServiceName != "" {
+		kvs[sqlApplication] = c.ServiceName
+	}
+	if len(sm.Baggage) > 0 {
+		kvs[sqlBaggage] = formatBaggage(sm.Baggage)
+	}
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var items []string
+	for _, k := range keys {
+		items = append(items, sqlEscape(k)+"='"+sqlEscape(kvs[k])+"'")
+	}
+	comment := "/*" + strings.Join(items, ",") + "*/"
+
+	if strings.HasSuffix(query, ";") {
+		c.Query = query[:len(query)-1] + " " + comment + ";"
+	} else {
+		c.Query = query + " " + comment
+	}
+	return nil
+}
+
+func sqlCommentExtracter(carrier interface{}) (SpanContext, error) {
+	c, ok := carrier.(*SQLCommentCarrier)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	_, kvs := ParseSQLComment(c.Query)
+	traceParent, ok := kvs[sqlTraceParent]
+	if !ok {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	ctx, err := parseTraceParent(traceParent)
+	if err != nil {
+		return SpanContext{}, err
+	}
+	parseBaggage(kvs[sqlBaggage], ctx.Baggage)
+	c.ServiceName = kvs[sqlApplication]
+	return ctx, nil
+}
+
+// ParseSQLComment parses a sqlcommenter-style comment at the end of
+// an SQL query, such as the ones injected with the SQLComment format.
+// It returns the query without the comment and the comment's
+// key/value pairs. If the query has no such comment, it is returned
+// unchanged, together with a nil map.
+func ParseSQLComment(query string) (string, map[string]string) {
+	q := strings.TrimRight(query, " \t\n")
+	semicolon := strings.HasSuffix(q, ";")
+	if semicolon {
+		q = strings.TrimRight(q[:len(q)-1], " \t\n")
+	}
+	if !strings.HasSuffix(q, "*/") {
+		return query, nil
+	}
+	start := strings.LastIndex(q, "/*")
+	if start == -1 {
+		return query, nil
+	}
+	comment := q[start+2 : len(q)-2]
+
+	kvs := map[string]string{}
+	for comment != "" {
+		idx := strings.Index(comment, "='")
+		if idx == -1 {
+			return query, nil
+		}
+		key := sqlUnescape(comment[:idx])
+		comment = comment[idx+2:]
+		// Find the closing quote, skipping escaped ones.
+		end := -1
+		for i := 0; i < len(comment); i++ {
+			if comment[i] == '\\' {
+				i++
+				continue
+			}
+			if comment[i] == '\'' {
+				end = i
+				break
+			}
+		}
+		if end == -1 {
+			return query, nil
+		}
+		kvs[key] = sqlUnescape(comment[:end])
+		comment = strings.TrimPrefix(comment[end+1:], ",")
+	}
+	if len(kvs) == 0 {
+		return query, nil
+	}
+
+	out := strings.TrimRight(q[:start], " \t\n")
+	if semicolon {
+		out += ";"
+	}
+	return out, kvs
+}
@@ -0,0 +1,130 @@
+package tracer
+
+import (
+	"fmt"
+
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// SpanKind describes the role of a span in a trace. Spans take their
+// kind from the OpenTracing span.kind tag.
+type SpanKind uint8
+
+// The various kinds of spans. Their values match those of the
+// protobuf representation.
+const (
+	// The kind of the span is unknown.
+	KindUnspecified SpanKind = iota
+	// The span is the client side of a remote call.
+	KindClient
+	// The span is the server side of a remote call.
+	KindServer
+	// The span sends a message to a consumer, without waiting for
+	// its response.
+	KindProducer
+	// The span receives a message from a producer.
+	KindConsumer
+	// The span is an operation within a process.
+	KindInternal
+)
+
+var kindNames = [...]string{"", "client", "server", "producer", "consumer", "internal"}
+
+func (k SpanKind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("SpanKind(%d)", k)
+}
+
+// ParseSpanKind returns the kind with the given name, as used by the
+// span.kind tag.
+func ParseSpanKind(s string) (SpanKind, error) {
+	for i, name := range kindNames {
+		if name == s {
+			return SpanKind(i), nil
+		}
+	}
+	return KindUnspecified, fmt.Errorf("unknown span kind %q", s)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (k SpanKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (k *SpanKind) UnmarshalText(b []byte) error {
+	var err error
+	*k, err = ParseSpanKind(string(b))
+	return err
+}
+
+// StatusCode describes whether the operation of a span succeeded.
+type StatusCode uint8
+
+// The various status codes. Their values match those of the protobuf
+// representation.
+const (
+	// The span didn't report a status.
+	StatusUnset StatusCode = iota
+	// The operation succeeded.
+	StatusOK
+	// The operation failed.
+	StatusError
+)
+
+var statusNames = [...]string{"", "ok", "error"}
+
+func (c StatusCode) String() string {
+	if int(c) < len(statusNames) {
+		return statusNames[c]
+	}
+	return fmt.Sprintf("StatusCode(%d)", c)
+}
+
+// ParseStatusCode returns the status code with the given name.
+func ParseStatusCode(s string) (StatusCode, error) {
+	for i, name := range statusNames {
+		if name == s {
+			return StatusCode(i), nil
+		}
+	}
+	return StatusUnset, fmt.Errorf("unknown status code %q", s)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (c StatusCode) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (c *StatusCode) UnmarshalText(b []byte) error {
+	var err error
+	*c, err = ParseStatusCode(string(b))
+	return err
+}
+
+// promotedTag returns the value of the span.kind or error tag that a
+// span's Kind or Status field was set from.
+func promotedTag(sp RawSpan, key string) (interface{}, bool) {
+	switch key {
+	case string(ext.SpanKind):
+		if sp.Kind != KindUnspecified {
+			return sp.Kind.String(), true
+		}
+	case string(ext.Error):
+		if sp.Status.Code != StatusUnset {
+			return sp.Status.Code == StatusError, true
+		}
+	}
+	return nil, false
+}
+
+// Status is the outcome of a span's operation. Spans take their status
+// from the OpenTracing error tag, which may be set to a bool, or to an
+// error, whose text becomes the message.
+type Status struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
@@ -0,0 +1,43 @@
+package tracer
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+func TestKindAndStatus(t *testing.T) {
+	storer := &memStorer{}
+	tr := NewTracer("svc", storer, RandomID{})
+	sp := tr.StartSpan("op", ext.SpanKindRPCClient)
+	ext.Error.Set(sp, true)
+	sp.SetTag(string(ext.Error), errors.New("boom"))
+	ext.Error.Set(sp, true)
+	sp.SetTag("other", 1)
+	sp.Finish()
+
+	raw := storer.spans[0]
+	if raw.Kind != KindClient {
+		t.Errorf("got kind %v, want client", raw.Kind)
+	}
+	if want := (Status{Code: StatusError, Message: "boom"}); raw.Status != want {
+		t.Errorf("got status %+v, want %+v", raw.Status, want)
+	}
+	if len(raw.Tags) != 1 {
+		t.Errorf("got tags %v, want only other", raw.Tags)
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	var got RawSpan
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if got.Kind != raw.Kind || got.Status != raw.Status {
+		t.Errorf("got %v %+v after JSON round trip, want %v %+v", got.Kind, got.Status, raw.Kind, raw.Status)
+	}
+}
@@ -0,0 +1,83 @@
+-- Upgrades a database whose spans kept their kind and status only in
+-- the span.kind and error tags. It adds the kind and status columns,
+-- fills them from the tags, and removes the tags that were promoted,
+-- which the all_tags view now provides instead. Import
+-- migrate_processes.sql first, as the view includes process tags.
+
+BEGIN;
+
+DO $$
+BEGIN
+       CREATE TYPE span_kind AS ENUM ('client', 'server', 'producer', 'consumer', 'internal');
+EXCEPTION
+       WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+       CREATE TYPE status_code AS ENUM ('ok', 'error');
+EXCEPTION
+       WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+       ALTER TABLE spans
+             ADD COLUMN kind span_kind NULL,
+             ADD COLUMN status_code status_code NULL,
+             ADD COLUMN status_message text NOT NULL DEFAULT '';
+EXCEPTION
+       WHEN duplicate_column THEN NULL;
+END $$;
+
+UPDATE spans SET kind = tags.value::span_kind
+FROM tags
+WHERE
+  tags.span_id = spans.id AND
+  tags.time IS NULL AND
+  tags.key = 'span.kind' AND
+  tags.value IN ('client', 'server', 'producer', 'consumer', 'internal') AND
+  spans.kind IS NULL;
+
+UPDATE spans SET status_code = CASE tags.value WHEN 'true' THEN 'error' ELSE 'ok' END::status_code
+FROM tags
+WHERE
+  tags.span_id = spans.id AND
+  tags.time IS NULL AND
+  tags.key = 'error' AND
+  tags.value IN ('true', 'false') AND
+  spans.status_code IS NULL;
+
+DELETE FROM tags
+USING spans
+WHERE
+  tags.span_id = spans.id AND
+  tags.time IS NULL AND
+  ((tags.key = 'span.kind' AND tags.value = spans.kind::text) OR
+   (tags.key = 'error' AND tags.value = (spans.status_code = 'error')::text));
+
+CREATE OR REPLACE VIEW all_tags (trace_id, span_id, key, value) AS
+SELECT trace_id, span_id, key, value FROM tags
+UNION ALL
+SELECT spans.trace_id, spans.id, process_tags.key, process_tags.value
+FROM spans JOIN process_tags ON process_tags.process_id = spans.process_id
+UNION ALL
+SELECT trace_id, id, 'span.kind', kind::text FROM spans WHERE kind IS NOT NULL
+UNION ALL
+SELECT trace_id, id, 'error', (status_code = 'error')::text FROM spans WHERE status_code IS NOT NULL;
+
+DROP MATERIALIZED VIEW IF EXISTS dependencies;
+
+CREATE MATERIALIZED VIEW dependencies (name1, name2, count) AS
+SELECT s1.service_name, s2.service_name, COUNT(*)
+FROM
+  spans AS s1
+    JOIN relations AS r ON r.span1_id = s1.id
+    JOIN spans AS s2 ON r.span2_id = s2.id
+WHERE
+  r.kind = 'parent' AND
+  s1.kind = 'client'
+GROUP BY
+  s1.service_name, s2.service_name;
+
+COMMIT;
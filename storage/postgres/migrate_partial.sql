@@ -0,0 +1,43 @@
+-- Upgrades a database that was created before spans could be stored
+-- repeatedly, as partial snapshots and then as finished spans. It adds
+-- the partial column of spans, marks the placeholders of parents that
+-- were never stored as partial, and adds the unique indexes that
+-- storing a span again relies on, removing duplicate tags and
+-- relations first.
+
+BEGIN;
+
+DO $$
+BEGIN
+       ALTER TABLE spans ADD COLUMN partial boolean NOT NULL DEFAULT false;
+EXCEPTION
+       WHEN duplicate_column THEN NULL;
+END $$;
+
+UPDATE spans SET partial = true
+WHERE
+  service_name = '' AND
+  operation_name = '' AND
+  NOT partial;
+
+DELETE FROM tags AS t1
+USING tags AS t2
+WHERE
+  t1.span_id = t2.span_id AND
+  t1.key = t2.key AND
+  COALESCE(t1.time, '-infinity') = COALESCE(t2.time, '-infinity') AND
+  t1.ctid > t2.ctid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_span_id_key_time ON tags (span_id, key, (COALESCE(time, '-infinity')));
+
+DELETE FROM relations AS r1
+USING relations AS r2
+WHERE
+  r1.span1_id = r2.span1_id AND
+  r1.span2_id = r2.span2_id AND
+  r1.kind = r2.kind AND
+  r1.ctid > r2.ctid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_relations_span1_id_span2_id_kind ON relations (span1_id, span2_id, kind);
+
+COMMIT;
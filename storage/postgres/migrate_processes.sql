@@ -0,0 +1,39 @@
+-- Upgrades a database that was created before spans had processes. It
+-- adds the processes and process_tags tables, the process_id column
+-- of spans, and the all_tags view. Existing spans have no process.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS processes (
+       id bigint PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS process_tags (
+       process_id bigint NOT NULL REFERENCES processes ON DELETE CASCADE,
+       key text NOT NULL,
+       value text NOT NULL,
+       PRIMARY KEY (process_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_process_tags_key_value ON process_tags (key, value);
+
+DO $$
+BEGIN
+       ALTER TABLE spans ADD COLUMN process_id bigint NULL REFERENCES processes;
+EXCEPTION
+       WHEN duplicate_column THEN NULL;
+END $$;
+
+-- Later migrations replace the view, so don't touch an existing one.
+DO $$
+BEGIN
+       CREATE VIEW all_tags (trace_id, span_id, key, value) AS
+       SELECT trace_id, span_id, key, value FROM tags
+       UNION ALL
+       SELECT spans.trace_id, spans.id, process_tags.key, process_tags.value
+       FROM spans JOIN process_tags ON process_tags.process_id = spans.process_id;
+EXCEPTION
+       WHEN duplicate_table THEN NULL;
+END $$;
+
+COMMIT;
@@ -7,6 +7,9 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -89,17 +92,29 @@ func New(db *sql.DB) *Storage {
 // Store implements the server.Storage interface.
 func (st *Storage) Store(sp tracer.RawSpan) (err error) {
 	const upsertSpan = `
-INSERT INTO spans (id, trace_id, time, service_name, operation_name)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO spans (id, trace_id, time, service_name, operation_name, process_id, kind, status_code, status_message, partial)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 ON CONFLICT (id) DO
   UPDATE SET
     time = $3,
     service_name = $4,
-    operation_name = $5`
-	const insertTag = `INSERT INTO tags (span_id, trace_id, key, value) VALUES ($1, $2, $3, $4)`
-	const insertLog = `INSERT INTO tags (span_id, trace_id, key, value, time) VALUES ($1, $2, $3, $4, $5)`
-	const insertParentRelation = `INSERT INTO relations (span1_id, span2_id, kind) VALUES ($1, $2, 'parent')`
-	const insertParentSpan = `INSERT INTO spans (id, trace_id, time, service_name, operation_name) VALUES ($1, $2, $3, '', '') ON CONFLICT (id) DO NOTHING`
+    operation_name = $5,
+    process_id = COALESCE($6, spans.process_id),
+    kind = $7,
+    status_code = $8,
+    status_message = $9,
+    partial = $10
+  WHERE spans.partial OR NOT EXCLUDED.partial`
+	const insertProcess = `INSERT INTO processes (id) VALUES ($1) ON CONFLICT (id) DO NOTHING`
+	const insertProcessTag = `INSERT INTO process_tags (process_id, key, value) VALUES ($1, $2, $3)`
+	const insertTag = `
+INSERT INTO tags (span_id, trace_id, key, value) VALUES ($1, $2, $3, $4)
+ON CONFLICT (span_id, key, (COALESCE(time, '-infinity'))) DO UPDATE SET value = $4`
+	const insertLog = `
+INSERT INTO tags (span_id, trace_id, key, value, time) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (span_id, key, (COALESCE(time, '-infinity'))) DO UPDATE SET value = $4`
+	const insertParentRelation = `INSERT INTO relations (span1_id, span2_id, kind) VALUES ($1, $2, 'parent') ON CONFLICT DO NOTHING`
+	const insertParentSpan = `INSERT INTO spans (id, trace_id, time, service_name, operation_name, partial) VALUES ($1, $2, $3, '', '', true) ON CONFLICT (id) DO NOTHING`
 
 	tx, err := st.db.Begin()
 	if err != nil {
@@ -113,11 +128,34 @@ ON CONFLICT (id) DO
 		err = tx.Commit()
 	}()
 
-	_, err = tx.Exec(upsertSpan,
-		int64(sp.SpanID), int64(sp.TraceID), timeRange{sp.StartTime, sp.FinishTime}, sp.ServiceName, sp.OperationName)
+	var processID sql.NullInt64
+	if sp.Process != nil {
+		processID = sql.NullInt64{Int64: hashProcess(sp.Process), Valid: true}
+		res, err := tx.Exec(insertProcess, processID.Int64)
+		if err != nil {
+			return err
+		}
+		// Only the first span of a process stores its tags.
+		if n, _ := res.RowsAffected(); n > 0 {
+			for k, v := range sp.Process.Tags {
+				if _, err := tx.Exec(insertProcessTag, processID.Int64, k, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	res, err := tx.Exec(upsertSpan,
+		int64(sp.SpanID), int64(sp.TraceID), timeRange{sp.StartTime, sp.FinishTime}, sp.ServiceName, sp.OperationName, processID,
+		nullString(sp.Kind.String()), nullString(sp.Status.Code.String()), sp.Status.Message, sp.Flags&tracer.FlagPartial != 0)
 	if err != nil {
 		return err
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// A partial snapshot arrived after the finished span; it has
+		// nothing to add.
+		return nil
+	}
 
 	if sp.ParentID != 0 {
 		_, err = tx.Exec(insertParentSpan,
@@ -163,6 +201,57 @@ ON CONFLICT (id) DO
 	return nil
 }
 
+// nullString returns s as a nullable string that is NULL if s is
+// empty.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// hashProcess returns an ID for a process that is derived from its
+// tags, so that equal processes are only stored once.
+func hashProcess(p *tracer.Process) int64 {
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, k := range keys {
+		_, _ = io.WriteString(h, k)
+		_, _ = h.Write([]byte{0})
+		_, _ = io.WriteString(h, p.Tags[k])
+		_, _ = h.Write([]byte{0})
+	}
+	return int64(h.Sum64())
+}
+
+// loadProcesses returns the processes that are selected by a query,
+// which must return process IDs and tag keys and values.
+func loadProcesses(tx *sql.Tx, query string, args ...interface{}) (map[int64]*tracer.Process, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	procs := map[int64]*tracer.Process{}
+	var (
+		id         int64
+		key, value string
+	)
+	for rows.Next() {
+		if err := rows.Scan(&id, &key, &value); err != nil {
+			return nil, err
+		}
+		p, ok := procs[id]
+		if !ok {
+			p = &tracer.Process{Tags: map[string]string{}}
+			procs[id] = p
+		}
+		p.Tags[key] = value
+	}
+	return procs, rows.Err()
+}
+
 // TraceByID implements the server.Storage interface.
 func (st *Storage) TraceByID(id uint64) (tracer.RawTrace, error) {
 	tx, err := st.db.Begin()
@@ -175,7 +264,7 @@ func (st *Storage) TraceByID(id uint64) (tracer.RawTrace, error) {
 
 func (st *Storage) traceByID(tx *sql.Tx, id uint64) (tracer.RawTrace, error) {
 	const selectTrace = `
-SELECT spans.id, spans.trace_id, spans.time, spans.service_name, spans.operation_name, tags.key, tags.value, tags.time
+SELECT spans.id, spans.trace_id, spans.time, spans.service_name, spans.operation_name, spans.process_id, spans.kind, spans.status_code, spans.status_message, spans.partial, tags.key, tags.value, tags.time
 FROM spans
   LEFT JOIN tags
     ON spans.id = tags.span_id
@@ -184,17 +273,25 @@ ORDER BY
   spans.time ASC,
   spans.id,
   tags.time ASC`
+	const selectProcesses = `
+SELECT process_id, key, value
+FROM process_tags
+WHERE process_id IN (SELECT process_id FROM spans WHERE trace_id = $1)`
 	const selectRelations = `
 SELECT r.span1_id, r.span2_id, r.kind
 FROM relations AS r
 JOIN spans ON spans.id = r.span1_id
 WHERE spans.trace_id = $1;
 `
+	procs, err := loadProcesses(tx, selectProcesses, int64(id))
+	if err != nil {
+		return tracer.RawTrace{}, err
+	}
 	rows, err := tx.Query(selectTrace, int64(id))
 	if err != nil {
 		return tracer.RawTrace{}, err
 	}
-	spans, err := scanSpans(rows)
+	spans, err := scanSpans(rows, procs)
 	if err != nil {
 		return tracer.RawTrace{}, err
 	}
@@ -227,7 +324,7 @@ WHERE spans.trace_id = $1;
 	}, nil
 }
 
-func scanSpans(rows *sql.Rows) ([]tracer.RawSpan, error) {
+func scanSpans(rows *sql.Rows, procs map[int64]*tracer.Process) ([]tracer.RawSpan, error) {
 	var spans []tracer.RawSpan
 	var (
 		prevSpanID int64
@@ -237,6 +334,11 @@ func scanSpans(rows *sql.Rows) ([]tracer.RawSpan, error) {
 		spanTime      timeRange
 		serviceName   string
 		operationName string
+		processID     sql.NullInt64
+		kind          sql.NullString
+		statusCode    sql.NullString
+		statusMessage string
+		partial       bool
 		tagKey        sql.NullString
 		tagValue      sql.NullString
 		tagTime       *time.Time
@@ -244,7 +346,7 @@ func scanSpans(rows *sql.Rows) ([]tracer.RawSpan, error) {
 	tagTime = new(time.Time)
 	var span tracer.RawSpan
 	for rows.Next() {
-		if err := rows.Scan(&spanID, &traceID, &spanTime, &serviceName, &operationName, &tagKey, &tagValue, &tagTime); err != nil {
+		if err := rows.Scan(&spanID, &traceID, &spanTime, &serviceName, &operationName, &processID, &kind, &statusCode, &statusMessage, &partial, &tagKey, &tagValue, &tagTime); err != nil {
 			return nil, err
 		}
 		if spanID != prevSpanID {
@@ -262,6 +364,16 @@ func scanSpans(rows *sql.Rows) ([]tracer.RawSpan, error) {
 		span.FinishTime = spanTime.End
 		span.ServiceName = serviceName
 		span.OperationName = operationName
+		if processID.Valid {
+			span.Process = procs[processID.Int64]
+		}
+		// The enum types of the columns only permit valid names.
+		span.Kind, _ = tracer.ParseSpanKind(kind.String)
+		span.Status.Code, _ = tracer.ParseStatusCode(statusCode.String)
+		span.Status.Message = statusMessage
+		if partial {
+			span.Flags |= tracer.FlagPartial
+		}
 		if tagKey.String != "" {
 			if tagTime == nil {
 				span.Tags[tagKey.String] = tagValue.String
@@ -295,18 +407,26 @@ func (st *Storage) SpanByID(id uint64) (tracer.RawSpan, error) {
 
 func (st *Storage) spanByID(tx *sql.Tx, id uint64) (tracer.RawSpan, error) {
 	const selectSpan = `
-SELECT spans.id, spans.trace_id, spans.time, spans.service_name, spans.operation_name, tags.key, tags.value, tags.time
+SELECT spans.id, spans.trace_id, spans.time, spans.service_name, spans.operation_name, spans.process_id, spans.kind, spans.status_code, spans.status_message, spans.partial, tags.key, tags.value, tags.time
 FROM spans
   LEFT JOIN tags
     ON spans.id = tags.span_id
 WHERE spans.id = $1
 LIMIT 1`
+	const selectProcess = `
+SELECT process_id, key, value
+FROM process_tags
+WHERE process_id = (SELECT process_id FROM spans WHERE id = $1)`
+	procs, err := loadProcesses(tx, selectProcess, int64(id))
+	if err != nil {
+		return tracer.RawSpan{}, err
+	}
 	rows, err := tx.Query(selectSpan, int64(id))
 	if err != nil {
 		return tracer.RawSpan{}, err
 	}
 	defer rows.Close()
-	spans, err := scanSpans(rows)
+	spans, err := scanSpans(rows, procs)
 	if err != nil {
 		return tracer.RawSpan{}, err
 	}
@@ -393,7 +513,7 @@ FROM spans
 WHERE
   EXISTS (
     SELECT 1
-    FROM tags
+    FROM all_tags AS tags
     WHERE
       tags.trace_id = spans.trace_id AND
       ` + strings.Join(conds, " AND ") + `
@@ -517,6 +637,14 @@ WHERE
   LOWER(time) < $1)
 `
 
-	_, err := st.db.Exec(query, before)
+	const purgeProcesses = `
+DELETE FROM processes
+WHERE NOT EXISTS (SELECT 1 FROM spans WHERE spans.process_id = processes.id)
+`
+
+	if _, err := st.db.Exec(query, before); err != nil {
+		return err
+	}
+	_, err := st.db.Exec(purgeProcesses)
 	return err
 }
@@ -6,12 +6,36 @@ CREATE OR REPLACE FUNCTION duration(d tstzrange) RETURNS bigint
        IMMUTABLE
        RETURNS NULL ON NULL INPUT;
 
+CREATE TABLE processes (
+       id bigint PRIMARY KEY
+);
+
+CREATE TABLE process_tags (
+       process_id bigint NOT NULL REFERENCES processes ON DELETE CASCADE,
+       key text NOT NULL,
+       value text NOT NULL,
+       PRIMARY KEY (process_id, key)
+);
+
+CREATE INDEX idx_process_tags_key_value ON process_tags (key, value);
+
+CREATE TYPE span_kind AS ENUM ('client', 'server', 'producer', 'consumer', 'internal');
+CREATE TYPE status_code AS ENUM ('ok', 'error');
+
 CREATE TABLE spans (
        id bigint PRIMARY KEY,
        trace_id bigint,
        time tstzrange NOT NULL,
        service_name text NOT NULL,
-       operation_name text NOT NULL
+       operation_name text NOT NULL,
+       process_id bigint NULL REFERENCES processes,
+       kind span_kind NULL,
+       status_code status_code NULL,
+       status_message text NOT NULL DEFAULT '',
+       -- partial is true for spans that haven't finished yet, either
+       -- because only snapshots of them have been stored, or because
+       -- they are placeholders for parents that haven't been stored.
+       partial boolean NOT NULL DEFAULT false
 );
 
 CREATE INDEX idx_spans_trace_id ON spans (trace_id);
@@ -30,6 +54,22 @@ CREATE TABLE tags (
 CREATE INDEX idx_tags_trace_id ON tags (trace_id);
 CREATE INDEX idx_tags_span_id ON tags (span_id);
 CREATE INDEX idx_tags_key_value ON tags (key, value);
+-- Storing a span repeatedly, for example as partial snapshots, updates
+-- its tags and logs instead of duplicating them.
+CREATE UNIQUE INDEX idx_tags_span_id_key_time ON tags (span_id, key, (COALESCE(time, '-infinity')));
+
+-- all_tags contains the tags of spans as well as the tags of their
+-- processes, for querying. It also contains the span.kind and error
+-- tags that spans' kinds and statuses were set from.
+CREATE VIEW all_tags (trace_id, span_id, key, value) AS
+SELECT trace_id, span_id, key, value FROM tags
+UNION ALL
+SELECT spans.trace_id, spans.id, process_tags.key, process_tags.value
+FROM spans JOIN process_tags ON process_tags.process_id = spans.process_id
+UNION ALL
+SELECT trace_id, id, 'span.kind', kind::text FROM spans WHERE kind IS NOT NULL
+UNION ALL
+SELECT trace_id, id, 'error', (status_code = 'error')::text FROM spans WHERE status_code IS NOT NULL;
 
 CREATE TYPE relation AS ENUM ('parent');
 
@@ -42,17 +82,16 @@ CREATE TABLE relations (
 
 CREATE INDEX idx_relations_span1_id ON relations (span1_id);
 CREATE INDEX idx_relations_span2_id ON relations (span2_id);
+CREATE UNIQUE INDEX idx_relations_span1_id_span2_id_kind ON relations (span1_id, span2_id, kind);
 
 CREATE MATERIALIZED VIEW dependencies (name1, name2, count) AS
 SELECT s1.service_name, s2.service_name, COUNT(*)
 FROM
   spans AS s1
-    JOIN tags AS t ON t.span_id = s1.id
     JOIN relations AS r ON r.span1_id = s1.id
     JOIN spans AS s2 ON r.span2_id = s2.id
 WHERE
   r.kind = 'parent' AND
-  t.key = 'span.kind' AND
-  t.value = 'client'
+  s1.kind = 'client'
 GROUP BY
   s1.service_name, s2.service_name;
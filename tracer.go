@@ -11,7 +11,30 @@
 // systems.
 //
 // Only root spans make sampling decisions. Child spans will inherit
-// the sampling decisions of the root spans.
+// the sampling decisions of the root spans, unless a remote parent
+// deferred the decision, like a B3 request without a sampling state
+// does; the sampler then decides for its children.
+//
+// The decision can be overridden by setting the sampling.priority tag
+// on any span, at any time: a priority greater than zero samples the
+// span, zero stops sampling it. The new decision applies to the span
+// itself and to children created afterwards. A span that is sampled
+// late only records tags and logs from then on.
+//
+// To keep unsampled requests cheap, unsampled children of unsampled
+// spans are started without applying their start options, unless the
+// tracer records metrics or the options set a sampling priority. Such
+// a child costs a single allocation, for the span itself. Like all
+// unsampled spans, they carry their context and baggage, and can be
+// sampled later.
+//
+// Long-running spans
+//
+// Spans are normally only stored once they finish. For operations that
+// run for a long time, such as streaming RPCs, a tracer can be
+// configured to store snapshots of open spans periodically, see
+// Tracer.HeartbeatInterval. Snapshots are flagged with FlagPartial and
+// merged into a single span by the storage.
 //
 // Errors and logging
 //
@@ -28,16 +51,26 @@ import (
 	"log"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+	"golang.org/x/net/context"
 )
 
 // The various flags of a Span.
 const (
 	// The Span has been sampled.
 	FlagSampled = 1 << iota
+	// The Span has been marked for debugging, for example by a B3
+	// debug flag. Debug spans are always sampled.
+	FlagDebug
+	// The Span is a snapshot of a span that hasn't finished yet, as
+	// stored by a tracer's heartbeat. Its finish time is the time of
+	// the snapshot. Later versions of the span, with the same ID,
+	// supersede it. The flag is never propagated.
+	FlagPartial
 )
 
 // A Logger logs messages.
@@ -95,6 +128,14 @@ type Span struct {
 	mu     sync.RWMutex
 	tracer *Tracer
 	raw    RawSpan
+
+	// Whether the span has been finished, after which the heartbeat
+	// no longer stores snapshots of it.
+	finished bool
+	// Fires every HeartbeatInterval while the span is open and
+	// sampled, and the number of times it fired.
+	heartbeat  *time.Timer
+	heartbeats int
 }
 
 // A RawSpan contains all the data associated with a span.
@@ -104,6 +145,11 @@ type RawSpan struct {
 	OperationName string    `json:"operation_name"`
 	StartTime     time.Time `json:"start_time"`
 	FinishTime    time.Time `json:"finish_time"`
+	Kind          SpanKind  `json:"kind,omitempty"`
+	Status        Status    `json:"status"`
+	// The process that emitted the span, if known. It is shared by
+	// all spans of the process.
+	Process *Process `json:"process,omitempty"`
 
 	Tags map[string]interface{} `json:"tags"`
 	Logs []opentracing.LogData  `json:"logs"`
@@ -113,6 +159,12 @@ type RawSpan struct {
 func (sp *Span) RawSpan() RawSpan {
 	sp.mu.Lock()
 	defer sp.mu.Unlock()
+	return sp.copyRaw()
+}
+
+// copyRaw returns a deep copy of the span's data. The caller must
+// hold sp.mu.
+func (sp *Span) copyRaw() RawSpan {
 	raw := sp.raw
 	tags := raw.Tags
 	raw.Tags = map[string]interface{}{}
@@ -120,6 +172,7 @@ func (sp *Span) RawSpan() RawSpan {
 		raw.Tags[k] = v
 	}
 	raw.Logs = append([]opentracing.LogData(nil), raw.Logs...)
+	raw.tracer = nil
 	baggage := raw.Baggage
 	raw.Baggage = map[string]string{}
 	for k, v := range baggage {
@@ -151,6 +204,13 @@ func (sp *Span) SetOperationName(name string) opentracing.Span {
 func (sp *Span) SetTag(key string, value interface{}) opentracing.Span {
 	sp.mu.Lock()
 	defer sp.mu.Unlock()
+	// Kind and status are tracked even for unsampled spans, for the
+	// tracer's metrics.
+	if sp.promoteTag(key, value) {
+		// The sampling priority may have sampled the span.
+		sp.armHeartbeat()
+		return sp
+	}
 	if !sp.sampled() {
 		return sp
 	}
@@ -165,20 +225,91 @@ func (sp *Span) SetTag(key string, value interface{}) opentracing.Span {
 	return sp
 }
 
+// promoteTag stores the span.kind and error tags in the span's Kind
+// and Status fields, and applies the sampling.priority tag to its
+// flags. It reports whether it did so; other tags, and tags with
+// values of unexpected types, are left to the caller.
+func (sp *Span) promoteTag(key string, value interface{}) bool {
+	switch key {
+	case string(ext.SamplingPriority):
+		prio, ok := samplingPriority(value)
+		if !ok {
+			return false
+		}
+		if prio > 0 {
+			sp.raw.Flags |= FlagSampled
+		} else {
+			sp.raw.Flags &^= FlagSampled | FlagDebug
+		}
+		return true
+	case string(ext.SpanKind):
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.String {
+			return false
+		}
+		kind, err := ParseSpanKind(rv.String())
+		if err != nil {
+			return false
+		}
+		sp.raw.Kind = kind
+		return true
+	case string(ext.Error):
+		switch v := value.(type) {
+		case bool:
+			if !v {
+				sp.raw.Status = Status{Code: StatusOK}
+			} else if sp.raw.Status.Code != StatusError {
+				sp.raw.Status = Status{Code: StatusError}
+			}
+			return true
+		case error:
+			sp.raw.Status = Status{Code: StatusError, Message: v.Error()}
+			return true
+		}
+	}
+	return false
+}
+
+// samplingPriority returns the value of a sampling.priority tag,
+// which may be of any integer type.
+func samplingPriority(value interface{}) (int64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > 0 {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
 // SetBaggageItem implements the opentracing.Tracer interface.
 func (sp *Span) SetBaggageItem(key, value string) opentracing.Span {
-	sp.raw.SpanContext.Baggage[key] = value
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	// Contexts share baggage, so it is copied on write.
+	baggage := make(map[string]string, len(sp.raw.Baggage)+1)
+	for k, v := range sp.raw.Baggage {
+		baggage[k] = v
+	}
+	baggage[key] = value
+	sp.raw.Baggage = baggage
 	return sp
 }
 
 // BaggageItem implements the opentracing.Tracer interface.
 func (sp *Span) BaggageItem(key string) string {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
 	return sp.raw.SpanContext.Baggage[key]
 }
 
 // Finish implements the opentracing.Span interface.
 func (sp *Span) Finish() {
-	if !sp.Sampled() {
+	if !sp.Sampled() && sp.tracer.Metrics == nil {
 		return
 	}
 	sp.FinishWithOptions(opentracing.FinishOptions{})
@@ -188,17 +319,29 @@ func (sp *Span) Finish() {
 func (sp *Span) FinishWithOptions(opts opentracing.FinishOptions) {
 	sp.mu.Lock()
 	defer sp.mu.Unlock()
-	if !sp.sampled() {
+	sp.finished = true
+	if sp.heartbeat != nil {
+		sp.heartbeat.Stop()
+	}
+	if !sp.sampled() && sp.tracer.Metrics == nil {
 		return
 	}
 	if opts.FinishTime.IsZero() {
 		opts.FinishTime = time.Now()
 	}
+	if sp.tracer.Metrics != nil {
+		sp.tracer.Metrics.observe(sp.raw, opts.FinishTime)
+	}
+	if !sp.sampled() {
+		return
+	}
 	sp.raw.FinishTime = opts.FinishTime
 	for _, log := range opts.BulkLogData {
 		sp.log(log)
 	}
-	if err := sp.tracer.storer.Store(sp.raw); err != nil {
+	raw := sp.raw
+	raw.tracer = nil
+	if err := sp.tracer.storer.Store(raw); err != nil {
 		sp.tracer.Logger.Printf("error while storing tracing span: %s", err)
 	}
 }
@@ -264,9 +407,40 @@ type Tracer struct {
 	ServiceName string
 	Logger      Logger
 	Sampler     Sampler
+	// The process that is attached to all spans. NewTracer detects
+	// it automatically; it may be replaced, but not modified, before
+	// the tracer is used.
+	Process *Process
+	// The formats used by the Composite format, in order of
+	// preference. NewTracer sets them to the native text format,
+	// W3C and B3.
+	CompositeFormats []interface{}
+	// If not nil, the policy that is applied to extracted span
+	// contexts.
+	TrustPolicy *TrustPolicy
+	// If not nil, records metrics about all finished spans, including
+	// unsampled ones.
+	Metrics *REDMetrics
+	// If not zero, sampled spans that are still open after this
+	// interval are stored as partial snapshots, flagged with
+	// FlagPartial, once per interval until they finish or reach
+	// MaxHeartbeats. Storers merge them with the finished span, which
+	// makes long operations visible while they run, and even if the
+	// process crashes. It must be set before the tracer is used.
+	HeartbeatInterval time.Duration
+	// The maximum number of snapshots stored of a single span, which
+	// bounds the work done for spans that are never finished.
+	// Defaults to 100.
+	MaxHeartbeats int
 
 	storer      Storer
 	idGenerator IDGenerator
+
+	propMu     sync.RWMutex
+	extracters map[interface{}]Extracter
+	injecters  map[interface{}]Injecter
+
+	closed int32
 }
 
 // NewTracer returns a new tracer.
@@ -275,6 +449,10 @@ func NewTracer(serviceName string, storer Storer, idGenerator IDGenerator) *Trac
 		ServiceName: serviceName,
 		Logger:      defaultLogger{},
 		Sampler:     NewConstSampler(true),
+		Process:     NewProcess(nil),
+		CompositeFormats: []interface{}{
+			opentracing.TextMap, W3C, B3,
+		},
 		storer:      storer,
 		idGenerator: idGenerator,
 	}
@@ -282,6 +460,9 @@ func NewTracer(serviceName string, storer Storer, idGenerator IDGenerator) *Trac
 
 // StartSpan implements the opentracing.Tracer interface.
 func (tr *Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	if sp := tr.unsampledChild(operationName, opts); sp != nil {
+		return sp
+	}
 	var sopts opentracing.StartSpanOptions
 	for _, opt := range opts {
 		opt.Apply(&sopts)
@@ -301,29 +482,180 @@ func (tr *Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanO
 			ServiceName:   tr.ServiceName,
 			OperationName: operationName,
 			StartTime:     sopts.StartTime,
+			Process:       tr.Process,
 		},
 	}
+	var parent SpanContext
 	if len(sopts.References) > 0 {
 		// TODO(dh): support multiple parents, support ChildOf and
 		// FollowsFrom as separate kinds of relations.
-		parent, ok := sopts.References[0].ReferencedContext.(SpanContext)
+		var ok bool
+		parent, ok = sopts.References[0].ReferencedContext.(SpanContext)
 		if !ok {
 			panic("parent span must be of type *Span")
 		}
+		// Baggage is copied on write, so it can be shared.
+		sp.raw.Baggage = parent.Baggage
+	}
+	if len(sopts.References) > 0 && !parent.untrusted {
 		sp.raw.ParentID = parent.SpanID
 		sp.raw.TraceID = parent.TraceID
 		sp.raw.Flags = parent.Flags
-	} else {
-		if n, _ := sopts.Tags[string(ext.SamplingPriority)].(uint16); n > 0 {
+		// If the remote parent deferred the decision, the sampler
+		// makes it, based on the trace ID, like for a root span.
+		if _, ok := samplingPriority(sopts.Tags[string(ext.SamplingPriority)]); !ok && parent.deferred && tr.Sampler.Sample(parent.TraceID) {
 			sp.raw.Flags |= FlagSampled
-		} else if tr.Sampler.Sample(id) {
+		}
+	} else {
+		// An explicit sampling priority is applied below, and
+		// takes the place of the sampler.
+		if _, ok := samplingPriority(sopts.Tags[string(ext.SamplingPriority)]); !ok && tr.Sampler.Sample(id) {
 			sp.raw.Flags |= FlagSampled
 		}
+		if parent.untrusted {
+			// The untrusted remote span is only recorded as a link.
+			if sopts.Tags == nil {
+				sopts.Tags = map[string]interface{}{}
+			}
+			sopts.Tags["link.trace_id"] = idToHex(parent.TraceID)
+			sopts.Tags["link.span_id"] = idToHex(parent.SpanID)
+		}
+	}
+	for k, v := range sopts.Tags {
+		if sp.promoteTag(k, v) {
+			delete(sopts.Tags, k)
+		}
 	}
 	sp.raw.Tags = sopts.Tags
+	sp.raw.tracer = tr
+	if tr.HeartbeatInterval > 0 && sp.sampled() {
+		sp.mu.Lock()
+		sp.armHeartbeat()
+		sp.mu.Unlock()
+	}
+	return sp
+}
+
+// unsampledChild starts a span that will be an unsampled child of one
+// of the tracer's own spans. Such spans don't record tags or logs
+// unless they are sampled later, so the options aren't applied; to
+// avoid allocating more than the span, they are inspected directly
+// instead. It gives up, returning nil, for options of unknown types,
+// for options that set a sampling priority, and if the tracer records
+// metrics, which need the span's tags.
+func (tr *Tracer) unsampledChild(operationName string, opts []opentracing.StartSpanOption) *Span {
+	if tr.Metrics != nil {
+		return nil
+	}
+	var (
+		parent    SpanContext
+		startTime time.Time
+		found     bool
+	)
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case opentracing.SpanReference:
+			if !found && opt.ReferencedContext != nil {
+				parent, _ = opt.ReferencedContext.(SpanContext)
+				found = true
+			}
+		case opentracing.Tags:
+			if _, ok := opt[string(ext.SamplingPriority)]; ok {
+				return nil
+			}
+		case opentracing.Tag:
+			if opt.Key == string(ext.SamplingPriority) {
+				return nil
+			}
+		case opentracing.StartTime:
+			startTime = time.Time(opt)
+		default:
+			return nil
+		}
+	}
+	if parent.tracer != tr || parent.Flags&FlagSampled != 0 || parent.untrusted {
+		return nil
+	}
+	if startTime.IsZero() {
+		startTime = time.Now()
+	}
+	sp := &Span{
+		tracer: tr,
+		raw: RawSpan{
+			SpanContext: SpanContext{
+				SpanID:   tr.idGenerator.GenerateID(),
+				ParentID: parent.SpanID,
+				TraceID:  parent.TraceID,
+				Flags:    parent.Flags,
+				// Baggage is copied on write, so it can be shared.
+				Baggage: parent.Baggage,
+				tracer:  tr,
+			},
+			ServiceName:   tr.ServiceName,
+			OperationName: operationName,
+			StartTime:     startTime,
+			Process:       tr.Process,
+		},
+	}
+	// The kind and status are kept in case the span is sampled later.
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case opentracing.Tags:
+			for k, v := range opt {
+				sp.promoteTag(k, v)
+			}
+		case opentracing.Tag:
+			sp.promoteTag(opt.Key, opt.Value)
+		}
+	}
 	return sp
 }
 
+// armHeartbeat schedules the first snapshot of an open, sampled span,
+// one interval from now, unless the heartbeat was armed before. Spans
+// that finish before then only cost a timer. The caller must hold
+// sp.mu.
+func (sp *Span) armHeartbeat() {
+	if sp.tracer.HeartbeatInterval <= 0 || sp.heartbeat != nil || sp.finished || !sp.sampled() {
+		return
+	}
+	sp.heartbeat = time.AfterFunc(sp.tracer.HeartbeatInterval, sp.storePartial)
+}
+
+// storePartial stores a snapshot of the span and schedules the next
+// one, until the span has had MaxHeartbeats snapshots. The snapshot
+// is copied under the span's lock but stored after releasing it, so
+// that a slow storer doesn't block the span's users. A snapshot may
+// therefore reach the storer after the finished span, which storers
+// must not let it replace.
+func (sp *Span) storePartial() {
+	sp.mu.Lock()
+	if sp.finished || !sp.sampled() || atomic.LoadInt32(&sp.tracer.closed) != 0 {
+		// Sampling the span again rearms the heartbeat.
+		sp.heartbeat = nil
+		sp.mu.Unlock()
+		return
+	}
+	sp.heartbeats++
+	if sp.heartbeats < sp.tracer.maxHeartbeats() {
+		sp.heartbeat.Reset(sp.tracer.HeartbeatInterval)
+	}
+	raw := sp.copyRaw()
+	sp.mu.Unlock()
+	raw.FinishTime = time.Now()
+	raw.Flags |= FlagPartial
+	if err := sp.tracer.storer.Store(raw); err != nil {
+		sp.tracer.Logger.Printf("error while storing partial tracing span: %s", err)
+	}
+}
+
+func (tr *Tracer) maxHeartbeats() int {
+	if tr.MaxHeartbeats <= 0 {
+		return 100
+	}
+	return tr.MaxHeartbeats
+}
+
 func (tr *Tracer) Flush() error {
 	f, ok := tr.storer.(Flusher)
 	if !ok {
@@ -332,6 +664,17 @@ func (tr *Tracer) Flush() error {
 	return f.Flush()
 }
 
+// Close closes the tracer's storer, which sends all buffered spans.
+// Storers that don't implement Closer are flushed instead. Tracers
+// that share a storer only need to be closed once.
+func (tr *Tracer) Close(ctx context.Context) error {
+	atomic.StoreInt32(&tr.closed, 1)
+	if c, ok := tr.storer.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return tr.Flush()
+}
+
 func idToHex(id uint64) string {
 	b := make([]byte, 8)
 	binary.BigEndian.PutUint64(b, id)
@@ -349,7 +692,13 @@ func (tr *Tracer) Inject(sm opentracing.SpanContext, format interface{}, carrier
 	if !ok {
 		return opentracing.ErrInvalidSpanContext
 	}
-	injecter, ok := injecters[format]
+	if tr.TrustPolicy != nil {
+		context = tr.TrustPolicy.signed(context)
+	}
+	if format == Composite {
+		return tr.injectComposite(context, carrier)
+	}
+	injecter, ok := tr.injecter(format)
 	if !ok {
 		return opentracing.ErrUnsupportedFormat
 	}
@@ -358,14 +707,26 @@ func (tr *Tracer) Inject(sm opentracing.SpanContext, format interface{}, carrier
 
 // Extract implements the opentracing.Tracer interface.
 func (tr *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
-	extracter, ok := extracters[format]
-	if !ok {
-		return nil, opentracing.ErrUnsupportedFormat
+	var context SpanContext
+	var err error
+	if format == Composite {
+		context, err = tr.extractComposite(carrier)
+	} else {
+		extracter, ok := tr.extracter(format)
+		if !ok {
+			return nil, opentracing.ErrUnsupportedFormat
+		}
+		context, err = extracter(carrier)
 	}
-	context, err := extracter(carrier)
 	if err != nil {
 		return nil, err
 	}
+	if tr.TrustPolicy != nil {
+		context, err = tr.TrustPolicy.check(context)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return context, nil
 }
 
@@ -380,10 +741,12 @@ type IDGenerator interface {
 // collector.
 //
 // If a span with the same ID and the same trace ID already exists,
-// the existing and new spans should be merged into one span.
+// the existing and new spans should be merged into one span. A span
+// flagged with FlagPartial must not replace a span that isn't.
 //
 // Because spans are only stored once they're done, children will be
-// stored before their parents.
+// stored before their parents. Partial snapshots of long-running
+// spans are the exception.
 type Storer interface {
 	Store(sp RawSpan) error
 }
@@ -394,6 +757,14 @@ type Flusher interface {
 	Flush() error
 }
 
+// Closer is an optional interface that when implemented allows a
+// Storer to send buffered spans and release its resources before the
+// program exits. Close should return once ctx expires, even if not
+// all spans could be sent.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
 var _ IDGenerator = RandomID{}
 
 // RandomID generates random IDs by using crypto/rand.
@@ -410,3 +781,29 @@ func (RandomID) GenerateID() uint64 {
 		}
 	}
 }
+
+var _ IDGenerator = (*PseudoRandomID)(nil)
+
+// PseudoRandomID generates random IDs by using a pseudo-random
+// number generator that is seeded from crypto/rand. It is much cheaper
+// than RandomID, but its IDs are predictable to anyone who observes
+// enough of them. It is safe for concurrent use.
+type PseudoRandomID struct {
+	state uint64
+}
+
+// NewPseudoRandomID returns a new PseudoRandomID.
+func NewPseudoRandomID() *PseudoRandomID {
+	return &PseudoRandomID{state: RandomID{}.GenerateID()}
+}
+
+// GenerateID generates an ID.
+func (g *PseudoRandomID) GenerateID() uint64 {
+	for {
+		// SplitMix64: a Weyl sequence, scrambled by mix64.
+		x := mix64(atomic.AddUint64(&g.state, 0x9e3779b97f4a7c15))
+		if x != 0 {
+			return x
+		}
+	}
+}
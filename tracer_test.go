@@ -0,0 +1,166 @@
+package tracer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"golang.org/x/net/context"
+)
+
+type nullStorer struct{}
+
+func (nullStorer) Store(RawSpan) error { return nil }
+
+func benchmarkStartFinish(b *testing.B, sampled bool, idGenerator IDGenerator) {
+	tr := NewTracer("svc", nullStorer{}, idGenerator)
+	tr.Sampler = NewConstSampler(sampled)
+	root := tr.StartSpan("root")
+	// Reuse the options, so that only the tracer's allocations count.
+	opts := []opentracing.StartSpanOption{opentracing.ChildOf(root.Context())}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp := tr.StartSpan("op", opts...)
+		sp.Finish()
+	}
+}
+
+func BenchmarkStartFinishUnsampled(b *testing.B) {
+	benchmarkStartFinish(b, false, NewPseudoRandomID())
+}
+
+func BenchmarkStartFinishSampled(b *testing.B) {
+	benchmarkStartFinish(b, true, NewPseudoRandomID())
+}
+
+func BenchmarkStartFinishRoot(b *testing.B) {
+	tr := NewTracer("svc", nullStorer{}, NewPseudoRandomID())
+	tr.Sampler = NewConstSampler(false)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp := tr.StartSpan("op")
+		sp.Finish()
+	}
+}
+
+func BenchmarkRandomID(b *testing.B) {
+	g := RandomID{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		g.GenerateID()
+	}
+}
+
+func BenchmarkPseudoRandomID(b *testing.B) {
+	g := NewPseudoRandomID()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		g.GenerateID()
+	}
+}
+
+func TestUnsampledChildren(t *testing.T) {
+	storer := &memStorer{}
+	tr := NewTracer("svc", storer, NewPseudoRandomID())
+	tr.Sampler = NewConstSampler(false)
+	root := tr.StartSpan("root")
+	root.SetBaggageItem("k", "v")
+	rctx := root.Context().(SpanContext)
+
+	child := tr.StartSpan("child", opentracing.ChildOf(root.Context()), opentracing.Tag{Key: string(ext.SpanKind), Value: "client"})
+	ctx := child.Context().(SpanContext)
+	if ctx.TraceID != rctx.TraceID || ctx.ParentID != rctx.SpanID || ctx.SpanID == rctx.SpanID || ctx.Baggage["k"] != "v" {
+		t.Errorf("got context %+v for child of %+v", ctx, rctx)
+	}
+	child.SetBaggageItem("k", "child")
+	grandchild := tr.StartSpan("grandchild", opentracing.ChildOf(child.Context()))
+	if grandchild.BaggageItem("k") != "child" || root.BaggageItem("k") != "v" {
+		t.Error("baggage wasn't propagated, or was modified in place")
+	}
+	grandchild.Finish()
+
+	child.SetTag(string(ext.SamplingPriority), 1)
+	child.SetTag("key", "value")
+	if !child.(*Span).Sampled() {
+		t.Fatal("child with sampling priority wasn't sampled")
+	}
+	sampled := tr.StartSpan("sampled", opentracing.ChildOf(child.Context()))
+	if !sampled.(*Span).Sampled() {
+		t.Error("child of upgraded span wasn't sampled")
+	}
+	sampled.Finish()
+	child.Finish()
+	root.Finish()
+	if len(storer.spans) != 2 {
+		t.Fatalf("got %d stored spans, want 2", len(storer.spans))
+	}
+	raw := storer.spans[1]
+	if raw.SpanID != ctx.SpanID || raw.ParentID != rctx.SpanID || raw.Kind != KindClient || raw.Tags["key"] != "value" {
+		t.Errorf("got upgraded span %+v", raw)
+	}
+
+	opts := []opentracing.StartSpanOption{opentracing.ChildOf(root.Context())}
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.StartSpan("op", opts...).Finish()
+	})
+	if allocs != 1 {
+		t.Errorf("got %v allocations per unsampled child, want 1 for the span", allocs)
+	}
+}
+
+type chanStorer chan RawSpan
+
+func (ch chanStorer) Store(sp RawSpan) error {
+	ch <- sp
+	return nil
+}
+
+func TestHeartbeat(t *testing.T) {
+	storer := make(chanStorer, 10)
+	tr := NewTracer("svc", storer, NewPseudoRandomID())
+	tr.HeartbeatInterval = time.Millisecond
+	tr.MaxHeartbeats = 3
+	defer tr.Close(context.Background())
+
+	sp := tr.StartSpan("stream", opentracing.Tag{Key: "k", Value: "v"}).(*Span)
+	for i := 0; i < tr.MaxHeartbeats; i++ {
+		partial := <-storer
+		if partial.Flags&FlagPartial == 0 || partial.FinishTime.IsZero() || partial.Tags["k"] != "v" {
+			t.Errorf("got snapshot %+v, want partial span with tags", partial)
+		}
+	}
+	if sp.Context().(SpanContext).Flags&FlagPartial != 0 {
+		t.Error("partial flag leaked into the span's context")
+	}
+	// The last snapshot doesn't schedule another one.
+	sp.mu.Lock()
+	armed := sp.heartbeat.Stop()
+	sp.mu.Unlock()
+	if armed {
+		t.Errorf("heartbeat still armed after %d snapshots", tr.MaxHeartbeats)
+	}
+
+	sp.Finish()
+	if raw := <-storer; raw.Flags&FlagPartial != 0 {
+		t.Errorf("got snapshot %+v, want finished span", raw)
+	}
+	sp.storePartial()
+	if len(storer) != 0 {
+		t.Errorf("got snapshot %+v of a finished span", <-storer)
+	}
+
+	// Unsampled spans only get a heartbeat once they are sampled.
+	tr.Sampler = NewConstSampler(false)
+	unsampled := tr.StartSpan("unsampled").(*Span)
+	if unsampled.heartbeat != nil {
+		t.Error("unsampled span has a heartbeat")
+	}
+	unsampled.SetTag(string(ext.SamplingPriority), 1)
+	if raw := <-storer; raw.Flags&FlagPartial == 0 || raw.OperationName != "unsampled" {
+		t.Errorf("got %+v, want snapshot of span sampled later", raw)
+	}
+	unsampled.Finish()
+}
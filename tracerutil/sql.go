@@ -0,0 +1,27 @@
+package tracerutil
+
+import (
+	"github.com/tracer/tracer"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// SQLComment returns query with a comment appended that identifies
+// the trace and span that issued it, as well as the service name if
+// sp was created by a *tracer.Tracer. The comment follows the
+// sqlcommenter conventions and shows up in database logs, such as
+// PostgreSQL's slow query log.
+//
+// If the tracer doesn't support the tracer.SQLComment format, query
+// is returned unchanged.
+func SQLComment(sp opentracing.Span, query string) string {
+	carrier := &tracer.SQLCommentCarrier{Query: query}
+	tr := sp.Tracer()
+	if t, ok := tr.(*tracer.Tracer); ok {
+		carrier.ServiceName = t.ServiceName
+	}
+	if err := tr.Inject(sp.Context(), tracer.SQLComment, carrier); err != nil {
+		return query
+	}
+	return carrier.Query
+}
@@ -3,14 +3,13 @@ package grpc
 
 import (
 	"errors"
+	"io"
 	"net"
 
-	"github.com/tracer/tracer"
 	"github.com/tracer/tracer/internal/pbutil"
 	"github.com/tracer/tracer/pb"
 	"github.com/tracer/tracer/server"
 
-	"github.com/opentracing/opentracing-go"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
@@ -47,47 +46,39 @@ func (g *GRPC) Start() error {
 }
 
 func (g *GRPC) Store(ctx context.Context, req *pb.StoreRequest) (*pb.StoreResponse, error) {
-	for _, span := range req.Spans {
-		st, err := pbutil.Timestamp(span.StartTime)
-		if err != nil {
-			return nil, err
+	if err := g.store(req); err != nil {
+		return &pb.StoreResponse{}, err
+	}
+	return &pb.StoreResponse{}, nil
+}
+
+func (g *GRPC) StoreStream(stream pb.Storer_StoreStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
 		}
-		ft, err := pbutil.Timestamp(span.FinishTime)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		sp := tracer.RawSpan{
-			SpanContext: tracer.SpanContext{
-				TraceID:  span.TraceId,
-				ParentID: span.ParentId,
-				SpanID:   span.SpanId,
-				Flags:    span.Flags,
-			},
-			ServiceName:   span.ServiceName,
-			OperationName: span.OperationName,
-			StartTime:     st,
-			FinishTime:    ft,
-			Tags:          map[string]interface{}{},
+		if err := g.store(req); err != nil {
+			return err
 		}
-		for _, tag := range span.Tags {
-			if tag.Time != nil {
-				t, err := pbutil.Timestamp(tag.Time)
-				if err != nil {
-					return nil, err
-				}
-				sp.Logs = append(sp.Logs, opentracing.LogData{
-					Event:     tag.Key,
-					Payload:   tag.Value,
-					Timestamp: t,
-				})
-			} else {
-				sp.Tags[tag.Key] = tag.Value
-			}
+		if err := stream.Send(&pb.StoreResponse{}); err != nil {
+			return err
 		}
+	}
+}
 
-		if err := g.srv.Storage.Store(sp); err != nil {
-			return &pb.StoreResponse{}, err
+func (g *GRPC) store(req *pb.StoreRequest) error {
+	spans, err := pbutil.RawSpans(req)
+	if err != nil {
+		return err
+	}
+	for _, sp := range spans {
+		if err := g.srv.Store(sp); err != nil {
+			return err
 		}
 	}
-	return &pb.StoreResponse{}, nil
+	return nil
 }
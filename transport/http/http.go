@@ -1,4 +1,4 @@
-// Package http is an HTTP-based query transport.
+// Package http implements HTTP-based query and storage transports.
 package http
 
 import (
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/tracer/tracer"
+	"github.com/tracer/tracer/internal/pbutil"
+	"github.com/tracer/tracer/pb"
+	"github.com/tracer/tracer/server"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func init() {
+	server.RegisterStorageTransport("http", setupStorage)
+}
+
+// maxBodySize limits the size of decompressed request bodies.
+const maxBodySize = 32 * 1024 * 1024
+
+func setupStorage(srv *server.Server, conf map[string]interface{}) (server.StorageTransport, error) {
+	listen, ok := conf["listen"].(string)
+	if !ok {
+		return nil, errors.New("missing listen setting for HTTP transport")
+	}
+	h := &Storage{
+		srv:    srv,
+		listen: listen,
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/spans", h.Spans)
+	return h, nil
+}
+
+// Storage is an HTTP-based storage transport. It accepts the batches
+// sent by tracer.HTTP.
+type Storage struct {
+	srv    *server.Server
+	listen string
+	mux    *http.ServeMux
+}
+
+// Start implements the server.StorageTransport interface.
+func (h *Storage) Start() error {
+	return http.ListenAndServe(h.listen, h.mux)
+}
+
+func (h *Storage) Spans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gr.Close()
+		body = gr
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(b) > maxBodySize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var spans []tracer.RawSpan
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/json":
+		if err := json.Unmarshal(b, &spans); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "application/x-protobuf":
+		req := &pb.StoreRequest{}
+		if err := proto.Unmarshal(b, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		spans, err = pbutil.RawSpans(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	for _, sp := range spans {
+		if err := h.srv.Store(sp); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"sort"
 	"strconv"
@@ -120,26 +121,36 @@ func traceToZipkin(trace tracer.RawTrace) zipkinTrace {
 	}
 	for _, span := range trace.Spans {
 		var kind, opKind string
-		switch span.Tags["span.kind"] {
-		case "server":
+		switch span.Kind {
+		case tracer.KindServer:
 			kind = "sr"
 			opKind = "ss"
-		case "client":
+		case tracer.KindClient:
 			kind = "cs"
 			opKind = "cr"
+		case tracer.KindProducer:
+			kind = "ms"
+		case tracer.KindConsumer:
+			kind = "mr"
+		}
+		endpoint := zipkinEndpoint{
+			ServiceName: span.ServiceName,
+		}
+		if span.Process != nil {
+			if ip := net.ParseIP(span.Process.Tags["ip"]); ip.To4() != nil {
+				endpoint.IPv4 = ip.String()
+			}
 		}
 		zspan := zipkinSpan{
 			Annotations: []zipkinAnnotation{
 				{
-					Endpoint: zipkinEndpoint{
-						ServiceName: span.ServiceName,
-					},
+					Endpoint:  endpoint,
 					Timestamp: int(span.StartTime.UnixNano()) / 1000,
 					Value:     kind,
 				},
 			},
 			BinaryAnnotations: []zipkinBinaryAnnotation{},
-			Debug:             false,
+			Debug:             span.Flags&tracer.FlagDebug > 0,
 			Duration:          int(span.FinishTime.Sub(span.StartTime)) / 1000,
 			ID:                fmt.Sprintf("%016x", span.SpanID),
 			Name:              span.OperationName,
@@ -150,28 +161,41 @@ func traceToZipkin(trace tracer.RawTrace) zipkinTrace {
 		if parents[span.SpanID] == 0 {
 			zspan.ParentID = ""
 		}
+		failed := span.Status.Code == tracer.StatusError
 		for k, v := range span.Tags {
+			if k == "error" && failed {
+				// The status below takes the place of the tag.
+				continue
+			}
 			vs := fmt.Sprintf("%v", v)
 			zspan.BinaryAnnotations = append(zspan.BinaryAnnotations, zipkinBinaryAnnotation{
 				Key:   k,
 				Value: vs,
 			})
 		}
+		if failed {
+			// Zipkin marks failed spans with an error annotation
+			// that holds the message.
+			msg := span.Status.Message
+			if msg == "" {
+				msg = "true"
+			}
+			zspan.BinaryAnnotations = append(zspan.BinaryAnnotations, zipkinBinaryAnnotation{
+				Key:   "error",
+				Value: msg,
+			})
+		}
 		for _, log := range span.Logs {
 			zspan.Annotations = append(zspan.Annotations,
 				zipkinAnnotation{
-					Endpoint: zipkinEndpoint{
-						ServiceName: span.ServiceName,
-					},
+					Endpoint:  endpoint,
 					Timestamp: int(log.Timestamp.UnixNano()) / 1000,
 					Value:     log.Event,
 				})
 		}
 		zspan.Annotations = append(zspan.Annotations,
 			zipkinAnnotation{
-				Endpoint: zipkinEndpoint{
-					ServiceName: span.ServiceName,
-				},
+				Endpoint:  endpoint,
 				Timestamp: int(span.FinishTime.UnixNano()) / 1000,
 				Value:     opKind,
 			})
@@ -0,0 +1,151 @@
+package tracer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// UntrustedAction determines what a Tracer does with span contexts
+// that it extracted from untrusted sources.
+type UntrustedAction int
+
+const (
+	// Reroot starts a new trace for untrusted span contexts. The new
+	// root span makes its own sampling decision and records the
+	// remote span in the link.trace_id and link.span_id tags.
+	Reroot UntrustedAction = iota
+	// Ignore discards untrusted span contexts, as if the carrier
+	// contained no span context at all.
+	Ignore
+)
+
+// signatureKey is the baggage key that carries signatures of span
+// contexts. Signatures only cover what every format propagates: the
+// trace and span IDs, the sampled flag and baggage. This way, span
+// contexts can be signed in all formats.
+const signatureKey = "tracer-signature"
+
+// A TrustPolicy controls how a Tracer treats span contexts that it
+// extracts from inbound requests. Public-facing services should use
+// one, so that clients can neither force sampling nor inject
+// arbitrary baggage.
+//
+// Without a Key, all extracted span contexts are untrusted. With a
+// Key, the Tracer signs the span contexts it injects, and span
+// contexts with a valid signature are trusted. This allows internal
+// services to propagate traces through edge services.
+//
+// Signatures expire after MaxAge, which limits how long a captured
+// span context can be replayed to forge a trusted parent. Within
+// MaxAge, replays can't be detected, and the clocks of services that
+// share a key must not drift apart by more than MaxAge.
+type TrustPolicy struct {
+	// What to do with untrusted span contexts.
+	Untrusted UntrustedAction
+	// Whether to remove the baggage of untrusted span contexts.
+	StripBaggage bool
+	// The key used for HMAC-SHA256 signatures of span contexts.
+	Key []byte
+	// How long signatures are valid. Defaults to one minute.
+	MaxAge time.Duration
+}
+
+func (p *TrustPolicy) maxAge() time.Duration {
+	if p.MaxAge <= 0 {
+		return time.Minute
+	}
+	return p.MaxAge
+}
+
+// sign computes the signature of a span context that expires at
+// expiry, in Unix seconds. The signature has the form expiry.mac and
+// covers the expiry, the trace and span IDs, the sampled flag and
+// baggage, except for the signature itself.
+func (p *TrustPolicy) sign(sm SpanContext, expiry int64) string {
+	mac := hmac.New(sha256.New, p.Key)
+	b := make([]byte, 8*4)
+	binary.BigEndian.PutUint64(b, uint64(expiry))
+	binary.BigEndian.PutUint64(b[8:], sm.TraceID)
+	binary.BigEndian.PutUint64(b[16:], sm.SpanID)
+	binary.BigEndian.PutUint64(b[24:], sm.Flags&FlagSampled)
+	mac.Write(b)
+	keys := make([]string, 0, len(sm.Baggage))
+	for k := range sm.Baggage {
+		if k != signatureKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := sm.Baggage[k]
+		binary.BigEndian.PutUint64(b, uint64(len(k)))
+		binary.BigEndian.PutUint64(b[8:], uint64(len(v)))
+		mac.Write(b[:16])
+		mac.Write([]byte(k))
+		mac.Write([]byte(v))
+	}
+	return strconv.FormatInt(expiry, 10) + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify reports whether sig is a valid signature of sm that hasn't
+// expired yet.
+func (p *TrustPolicy) verify(sm SpanContext, sig string) bool {
+	idx := strings.IndexByte(sig, '.')
+	if idx == -1 {
+		return false
+	}
+	expiry, err := strconv.ParseInt(sig[:idx], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(p.sign(sm, expiry)))
+}
+
+// signed returns a copy of sm that carries its signature.
+func (p *TrustPolicy) signed(sm SpanContext) SpanContext {
+	if p.Key == nil {
+		return sm
+	}
+	baggage := make(map[string]string, len(sm.Baggage)+1)
+	for k, v := range sm.Baggage {
+		baggage[k] = v
+	}
+	baggage[signatureKey] = p.sign(sm, time.Now().Add(p.maxAge()).Unix())
+	sm.Baggage = baggage
+	return sm
+}
+
+// check applies the policy to an extracted span context.
+func (p *TrustPolicy) check(sm SpanContext) (SpanContext, error) {
+	sig, hasSig := sm.Baggage[signatureKey]
+	if hasSig {
+		baggage := make(map[string]string, len(sm.Baggage))
+		for k, v := range sm.Baggage {
+			if k != signatureKey {
+				baggage[k] = v
+			}
+		}
+		sm.Baggage = baggage
+	}
+	if p.Key != nil && hasSig && p.verify(sm, sig) {
+		return sm, nil
+	}
+
+	if p.Untrusted == Ignore {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	sm.untrusted = true
+	sm.Flags = 0
+	if p.StripBaggage {
+		sm.Baggage = map[string]string{}
+	}
+	return sm, nil
+}
@@ -0,0 +1,111 @@
+package tracer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tracer/tracer/pb"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// maxDatagramSize is the largest payload of a UDP datagram.
+const maxDatagramSize = 65507
+
+// udpLogInterval is the minimum time between two error messages of
+// the UDP storer.
+const udpLogInterval = 10 * time.Second
+
+// UDP is a fire-and-forget transport that sends each span in its own
+// UDP datagram, usually to an agent on the same host that batches
+// spans and forwards them to a server. Applications using it never
+// block on the network or hold connections to the server.
+//
+// Each datagram contains a protobuf StoreRequest. Spans that don't
+// fit into a single datagram are dropped. Spans that can't be sent
+// are dropped as well, for example while the agent is down. Store
+// doesn't return errors for dropped spans, but logs them, at most
+// once per ten seconds.
+type UDP struct {
+	conn   net.Conn
+	logger Logger
+	// Whether the storer is closed, accessed atomically.
+	closed int32
+
+	// mu guards lastLog and suppressed: when an error was logged
+	// last, and how many spans were dropped without logging since.
+	mu         sync.Mutex
+	lastLog    time.Time
+	suppressed int
+}
+
+// NewUDP returns a new Storer that sends spans via UDP to an agent,
+// such as the one started by "tracer agent".
+func NewUDP(address string, logger Logger) (Storer, error) {
+	if logger == nil {
+		logger = defaultLogger{}
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &UDP{conn: conn, logger: logger}, nil
+}
+
+// Store implements the tracer.Storer interface.
+func (u *UDP) Store(sp RawSpan) error {
+	if atomic.LoadInt32(&u.closed) != 0 {
+		return ErrStorerClosed
+	}
+	psp := spanToProto(sp)
+	req := &pb.StoreRequest{Spans: []*pb.Span{psp}}
+	if sp.Process != nil {
+		req.Processes = []*pb.Process{processToProto(sp.Process)}
+		psp.ProcessIndex = 1
+	}
+	b, err := proto.Marshal(req)
+	if err != nil {
+		u.drop(err)
+		return nil
+	}
+	if len(b) > maxDatagramSize {
+		u.drop(fmt.Errorf("span of %d bytes doesn't fit in a datagram", len(b)))
+		return nil
+	}
+	if _, err := u.conn.Write(b); err != nil {
+		u.drop(err)
+	}
+	return nil
+}
+
+// drop logs that a span was dropped because of err, unless an error
+// was logged less than udpLogInterval ago.
+func (u *UDP) drop(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now()
+	if now.Sub(u.lastLog) < udpLogInterval {
+		u.suppressed++
+		return
+	}
+	if u.suppressed > 0 {
+		u.logger.Printf("dropping span because of error: %s (dropped %d more spans since the last message)", err, u.suppressed)
+	} else {
+		u.logger.Printf("dropping span because of error: %s", err)
+	}
+	u.lastLog = now
+	u.suppressed = 0
+}
+
+// Close implements the tracer.Closer interface. It releases the
+// storer's socket; there are no buffered spans to send.
+func (u *UDP) Close(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&u.closed, 0, 1) {
+		return nil
+	}
+	return u.conn.Close()
+}
@@ -0,0 +1,73 @@
+package tracer
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tracer/tracer/pb"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+type logRecorder struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *logRecorder) Printf(format string, values ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, format)
+}
+
+func TestUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	defer pc.Close()
+	logger := &logRecorder{}
+	s, err := NewUDP(pc.LocalAddr().String(), logger)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	if err := s.Store(RawSpan{OperationName: "op"}); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	b := make([]byte, maxDatagramSize)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	req := &pb.StoreRequest{}
+	if err := proto.Unmarshal(b[:n], req); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if len(req.Spans) != 1 || req.Spans[0].OperationName != "op" {
+		t.Errorf("got request %v, want a single span", req)
+	}
+
+	// Dropped spans are logged, but not every one of them.
+	big := RawSpan{OperationName: strings.Repeat("x", maxDatagramSize)}
+	for i := 0; i < 3; i++ {
+		if err := s.Store(big); err != nil {
+			t.Error("unexpected error: ", err)
+		}
+	}
+	if len(logger.msgs) != 1 {
+		t.Errorf("got %d log messages for 3 dropped spans, want 1", len(logger.msgs))
+	}
+
+	if err := s.(Closer).Close(context.Background()); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if err := s.Store(RawSpan{}); err != ErrStorerClosed {
+		t.Errorf("got error %v after closing, want %v", err, ErrStorerClosed)
+	}
+}
@@ -0,0 +1,111 @@
+package tracer
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// The headers used by W3C Trace Context and W3C Baggage propagation.
+const (
+	w3cTraceParent = "traceparent"
+	w3cBaggage     = "baggage"
+)
+
+func w3cInjecter(sm SpanContext, carrier interface{}) error {
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	w.Set(w3cTraceParent, formatTraceParent(sm))
+	if len(sm.Baggage) > 0 {
+		w.Set(w3cBaggage, formatBaggage(sm.Baggage))
+	}
+	return nil
+}
+
+func w3cExtracter(carrier interface{}) (SpanContext, error) {
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var traceParent, baggage string
+	err := r.ForeachKey(func(key string, val string) error {
+		switch strings.ToLower(key) {
+		case w3cTraceParent:
+			traceParent = val
+		case w3cBaggage:
+			// The header may be split across multiple fields.
+			if baggage != "" {
+				baggage += ","
+			}
+			baggage += val
+		}
+		return nil
+	})
+	if err != nil {
+		return SpanContext{}, err
+	}
+	if traceParent == "" {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	ctx, err := parseTraceParent(strings.TrimSpace(traceParent))
+	if err != nil {
+		return SpanContext{}, err
+	}
+	parseBaggage(baggage, ctx.Baggage)
+	return ctx, nil
+}
+
+// formatBaggage formats baggage as a comma-separated list of
+// percent-encoded key=value items, as used by the W3C baggage header
+// and the BAGGAGE environment variable.
+func formatBaggage(baggage map[string]string) string {
+	items := make([]string, 0, len(baggage))
+	for k, v := range baggage {
+		items = append(items, baggageEscape(k)+"="+baggageEscape(v))
+	}
+	return strings.Join(items, ",")
+}
+
+// baggageEscape percent-encodes all bytes of s but letters, digits
+// and "-._~". Unlike form encoding, it never produces "+", which W3C
+// baggage doesn't decode as a space.
+func baggageEscape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			out = append(out, c)
+			continue
+		}
+		out = append(out, '%', hex[c>>4], hex[c&15])
+	}
+	return string(out)
+}
+
+// parseBaggage parses baggage in the format of formatBaggage into
+// dst. Malformed items, and the properties of items, are ignored.
+func parseBaggage(s string, dst map[string]string) {
+	if s == "" {
+		return
+	}
+	for _, item := range strings.Split(s, ",") {
+		if idx := strings.IndexByte(item, ';'); idx != -1 {
+			item = item[:idx]
+		}
+		idx := strings.IndexByte(item, '=')
+		if idx == -1 {
+			continue
+		}
+		k, err1 := url.PathUnescape(strings.TrimSpace(item[:idx]))
+		v, err2 := url.PathUnescape(strings.TrimSpace(item[idx+1:]))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		dst[k] = v
+	}
+}